@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// checkpoint tracks progress of import, all input lines up to Line are either imported or rejected.
+type checkpoint struct {
+	path string
+
+	Input    string `json:"input"`
+	Line     int    `json:"line"`
+	Imported int    `json:"imported"`
+	Rejected int    `json:"rejected"`
+}
+
+// loadCheckpoint reads checkpoint of input file or returns empty one if checkpoint file does not exist.
+func loadCheckpoint(path, input string) (*checkpoint, error) {
+	cp := &checkpoint{path: path, Input: filepath.Base(input)}
+	if path == "" {
+		return cp, nil
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(raw, cp); err != nil {
+		return nil, fmt.Errorf("decode checkpoint %s: %w", path, err)
+	}
+
+	if cp.Input != filepath.Base(input) {
+		return nil, usageErrorf("checkpoint %s belongs to %s, not %s", path, cp.Input, input)
+	}
+
+	return cp, nil
+}
+
+// save atomically replaces checkpoint file.
+func (cp *checkpoint) save() error {
+	if cp.path == "" {
+		return nil
+	}
+
+	raw, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+
+	tmp := cp.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(raw, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp, cp.path); err != nil {
+		return fmt.Errorf("write checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// rejection is the line of rejects report.
+type rejection struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+	Input string `json:"input,omitempty"`
+}
+
+// rejectsReport appends rejected rows to NDJSON file.
+type rejectsReport struct {
+	file    *os.File
+	encoder *json.Encoder
+}
+
+func openRejectsReport(path string) (*rejectsReport, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open rejects report: %w", err)
+	}
+
+	return &rejectsReport{file: f, encoder: json.NewEncoder(f)}, nil
+}
+
+func (r *rejectsReport) write(line int, input string, err error) error {
+	if err := r.encoder.Encode(&rejection{Line: line, Error: err.Error(), Input: input}); err != nil {
+		return fmt.Errorf("write rejects report: %w", err)
+	}
+
+	return nil
+}
+
+func (r *rejectsReport) Close() error {
+	return r.file.Close()
+}
+
+// countingReader counts bytes read from input to report progress.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+
+	return n, err
+}
+
+// isTerminal reports whether w is terminal, so progress bar does not flood logs of redirected output.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressBar renders import progress into a single terminal line.
+type progressBar struct {
+	out      io.Writer
+	total    int64
+	interval time.Duration
+	rendered time.Time
+}
+
+const progressWidth = 30
+
+// render draws progress no more than once per interval unless forced.
+func (p *progressBar) render(read int64, cp *checkpoint, force bool) {
+	if p == nil || (!force && time.Since(p.rendered) < p.interval) {
+		return
+	}
+
+	p.rendered = time.Now()
+
+	bar := ""
+
+	if p.total > 0 {
+		if read > p.total {
+			read = p.total
+		}
+
+		done := int(read * progressWidth / p.total)
+		bar = fmt.Sprintf("[%s%s] %3d%% ",
+			strings.Repeat("=", done), strings.Repeat(" ", progressWidth-done), read*100/p.total)
+	}
+
+	fmt.Fprintf(p.out, "\r%sline %d, %d imported, %d rejected", bar, cp.Line, cp.Imported, cp.Rejected)
+
+	if force {
+		fmt.Fprintln(p.out)
+	}
+}
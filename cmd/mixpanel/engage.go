@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"sort"
+
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+// engageFlags describes single profile action.
+type engageFlags struct {
+	distinctID string
+	op         string
+	properties propertyFlags
+}
+
+func (f *engageFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.distinctID, "distinct-id", "", "distinct `ID` of user, required")
+	fs.StringVar(&f.op, "op", "set", "profile `operation`: set, set-once, add, append, remove or unset")
+	f.properties.register(fs)
+}
+
+// action builds profile action from flags,
+// names of unset properties are taken from args and from names of passed properties.
+func (f *engageFlags) action(token string, args []string) (profile.Mutator, error) {
+	if f.distinctID == "" {
+		return nil, usageErrorf("-distinct-id is required")
+	}
+
+	properties, err := f.properties.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	if f.op != "unset" && len(args) > 0 {
+		return nil, usageErrorf("unexpected arguments %q", args)
+	}
+
+	if f.op != "unset" && len(properties) == 0 {
+		return nil, usageErrorf("properties are required, use -p or -props")
+	}
+
+	switch f.op {
+	case "set":
+		return &profile.Set{Token: token, DistinctID: f.distinctID, Set: properties}, nil
+	case "set-once":
+		return &profile.SetOnce{Token: token, DistinctID: f.distinctID, SetOnce: properties}, nil
+	case "add":
+		return &profile.NumberAdd{Token: token, DistinctID: f.distinctID, Add: properties}, nil
+	case "append":
+		return &profile.ListAppend{Token: token, DistinctID: f.distinctID, Append: properties}, nil
+	case "remove":
+		return &profile.ListRemove{Token: token, DistinctID: f.distinctID, Remove: properties}, nil
+	case "unset":
+		names := append([]string{}, args...)
+		for name := range properties {
+			names = append(names, name)
+		}
+
+		if len(names) == 0 {
+			return nil, usageErrorf("property names are required")
+		}
+
+		sort.Strings(names)
+
+		return &profile.Unset{Token: token, DistinctID: f.distinctID, Unset: names}, nil
+	}
+
+	return nil, usageErrorf("unknown operation %q", f.op)
+}
+
+func runEngage(ctx context.Context, e *env, args []string) error {
+	var (
+		cfg    config
+		engage engageFlags
+	)
+
+	fs := newFlagSet("engage", "[property names to unset]", e)
+	cfg.register(fs, e)
+	engage.register(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	action, err := engage.action(cfg.token, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	cli, err := cfg.client(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := cfg.context(ctx)
+	defer cancel()
+
+	return cli.Engage(ctx, action)
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+// importFlags describes import command.
+type importFlags struct {
+	path       string
+	format     string
+	mapping    string
+	checkpoint string
+	rejects    string
+	workers    int
+	progress   bool
+	insertID   bool
+}
+
+// register registers flags, progress bar is shown by default if stderr is terminal.
+func (f *importFlags) register(fs *flag.FlagSet, terminal bool) {
+	fs.StringVar(&f.path, "f", "", "input `file`, required")
+	fs.StringVar(&f.format, "format", "", "input `format`: ndjson or csv, default is detected by file extension")
+	fs.StringVar(&f.mapping, "mapping", "",
+		"JSON `file` mapping CSV columns to properties, default maps `event` column to event name "+
+			"and other columns to properties with the same names")
+	fs.StringVar(&f.checkpoint, "checkpoint", "", "checkpoint `file` to resume import, default is <input>.checkpoint")
+	fs.StringVar(&f.rejects, "rejects", "", "NDJSON `file` to report rejected rows, default is <input>.rejects.ndjson")
+	fs.IntVar(&f.workers, "workers", 4, "`number` of parallel requests")
+	fs.BoolVar(&f.progress, "progress", terminal, "show progress bar, default is true if stderr is terminal")
+	fs.BoolVar(&f.insertID, "insert-id", true,
+		"set $insert_id derived from input line to events without it, so Mixpanel deduplicates resent events")
+}
+
+// complete validates flags and sets defaults.
+func (f *importFlags) complete() error {
+	if f.path == "" {
+		return usageErrorf("-f is required")
+	}
+
+	if f.format == "" {
+		f.format = "ndjson"
+		if strings.EqualFold(filepath.Ext(f.path), ".csv") {
+			f.format = "csv"
+		}
+	}
+
+	switch {
+	case f.format != "ndjson" && f.format != "csv":
+		return usageErrorf("unknown format %q", f.format)
+	case f.mapping != "" && f.format != "csv":
+		return usageErrorf("-mapping requires csv format")
+	case f.workers < 1:
+		return usageErrorf("-workers must be positive")
+	}
+
+	if f.checkpoint == "" {
+		f.checkpoint = f.path + ".checkpoint"
+	}
+
+	if f.rejects == "" {
+		f.rejects = f.path + ".rejects.ndjson"
+	}
+
+	return nil
+}
+
+func (f *importFlags) source(r io.Reader) (source, error) {
+	if f.format == "ndjson" {
+		return newNDJSONSource(r), nil
+	}
+
+	var (
+		m   *mapping
+		err error
+	)
+
+	if f.mapping != "" {
+		if m, err = loadMapping(f.mapping); err != nil {
+			return nil, usageErrorf("%s", err)
+		}
+	}
+
+	return newCSVSource(r, m)
+}
+
+func runImport(ctx context.Context, e *env, args []string) error {
+	var (
+		cfg   config
+		flags importFlags
+	)
+
+	fs := newFlagSet("import", "", e)
+	cfg.register(fs, e)
+	flags.register(fs, isTerminal(e.stderr))
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := flags.complete(); err != nil {
+		return err
+	}
+
+	cli, err := cfg.client(e)
+	if err != nil {
+		return err
+	}
+
+	imp := &importer{cfg: &cfg, cli: cli, insertID: flags.insertID, workers: flags.workers}
+	if imp.cp, err = loadCheckpoint(flags.checkpoint, flags.path); err != nil {
+		return err
+	}
+
+	input, err := os.Open(flags.path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	if flags.progress {
+		imp.progress = &progressBar{out: e.stderr, interval: 200 * time.Millisecond}
+		if info, err := input.Stat(); err == nil {
+			imp.progress.total = info.Size()
+		}
+	}
+
+	counter := &countingReader{Reader: input}
+
+	src, err := flags.source(counter)
+	if err != nil {
+		return err
+	}
+
+	if imp.rejects, err = openRejectsReport(flags.rejects); err != nil {
+		return err
+	}
+	defer imp.rejects.Close()
+
+	err = imp.run(ctx, src, counter)
+	fmt.Fprintf(e.stderr, "%d events imported, %d rows rejected (%s), checkpoint at line %d (%s)\n",
+		imp.cp.Imported, imp.cp.Rejected, flags.rejects, imp.cp.Line, flags.checkpoint)
+
+	if err == nil && imp.cp.Rejected > 0 {
+		return fmt.Errorf("%d rows rejected, see %s", imp.cp.Rejected, flags.rejects)
+	}
+
+	return err
+}
+
+// importer sends rows in batches by parallel workers and commits results in order of input.
+type importer struct {
+	cfg      *config
+	cli      ingestion.Client
+	insertID bool
+	workers  int
+	cp       *checkpoint
+	rejects  *rejectsReport
+	progress *progressBar
+	consumed int64
+}
+
+// chunk is a batch of rows and rows rejected before sending, which follow the previous chunk in input.
+type chunk struct {
+	seq      int
+	rows     []*row
+	rejected []*row
+	// last is the last input line of the chunk
+	last int
+	// read is number of input bytes read to build the chunk
+	read int64
+}
+
+type chunkResult struct {
+	chunk *chunk
+	err   error
+}
+
+func (imp *importer) run(ctx context.Context, src source, counter *countingReader) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	chunks := make(chan *chunk, imp.workers)
+	results := make(chan *chunkResult, imp.workers)
+	readErr := make(chan error, 1)
+
+	skip := imp.cp.Line
+
+	go func() {
+		readErr <- readChunks(ctx, src, counter, skip, chunks)
+	}()
+
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < imp.workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for c := range chunks {
+				results <- &chunkResult{chunk: c, err: imp.send(ctx, c)}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	err := imp.collect(results, cancel)
+	if rerr := <-readErr; err == nil {
+		err = rerr
+	}
+
+	imp.progress.render(imp.consumed, imp.cp, true)
+
+	return err
+}
+
+// readChunks splits input into chunks skipping lines up to checkpoint.
+func readChunks(ctx context.Context, src source, counter *countingReader, skip int, chunks chan<- *chunk) error {
+	defer close(chunks)
+
+	c := &chunk{}
+	flush := func() bool {
+		if c.last == 0 {
+			return true
+		}
+
+		select {
+		case chunks <- c:
+		case <-ctx.Done():
+			return false
+		}
+
+		c = &chunk{seq: c.seq + 1}
+
+		return true
+	}
+
+	for {
+		r, err := src.next()
+		if err == io.EOF {
+			flush()
+
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("read input: %w", err)
+		}
+
+		if r.line <= skip {
+			continue
+		}
+
+		c.last, c.read = r.line, counter.n
+
+		if r.err != nil {
+			c.rejected = append(c.rejected, r)
+		} else {
+			c.rows = append(c.rows, r)
+		}
+
+		if len(c.rows) == ingestion.TrackBatchLimit && !flush() {
+			return nil
+		}
+	}
+}
+
+func (imp *importer) send(ctx context.Context, c *chunk) error {
+	if len(c.rows) == 0 {
+		return nil
+	}
+
+	batch := make([]*event.Data, 0, len(c.rows))
+
+	for _, r := range c.rows {
+		if r.data.Properties.Token == "" {
+			r.data.Properties.Token = imp.cfg.token
+		}
+
+		if imp.insertID && r.data.Properties.InsertID == "" {
+			r.data.Properties.InsertID = insertID(r)
+		}
+
+		batch = append(batch, r.data)
+	}
+
+	ctx, cancel := imp.cfg.context(ctx)
+	defer cancel()
+
+	return imp.cli.TrackBatch(ctx, batch)
+}
+
+// insertID derives event ID from input line, so events resent after resume are deduplicated by Mixpanel.
+func insertID(r *row) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(r.line) + ":" + r.input))
+
+	return hex.EncodeToString(sum[:16])
+}
+
+// collect commits results in order of chunks, import stops on the first failure which is not rejection of rows.
+func (imp *importer) collect(results <-chan *chunkResult, cancel context.CancelFunc) error {
+	var failure error
+
+	done := map[int]*chunkResult{}
+	next := 0
+
+	for res := range results {
+		if failure != nil {
+			continue
+		}
+
+		if res.err != nil && !rowsRejected(res.err) {
+			failure = fmt.Errorf("lines up to %d: %w", res.chunk.last, res.err)
+
+			cancel()
+
+			continue
+		}
+
+		done[res.chunk.seq] = res
+
+		for ; done[next] != nil; next++ {
+			if err := imp.commit(done[next]); err != nil {
+				failure = err
+
+				cancel()
+
+				break
+			}
+
+			delete(done, next)
+		}
+
+		imp.progress.render(imp.consumed, imp.cp, false)
+	}
+
+	return failure
+}
+
+// rowsRejected reports whether Mixpanel rejected rows of the batch.
+// Other failures, e.g. invalid credentials or project token, do not depend on rows and must stop import
+// before checkpoint is moved, otherwise all remaining rows would be reported as rejected.
+func rowsRejected(err error) bool {
+	var respErr *ingestion.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusOK {
+		return false
+	}
+
+	return !strings.Contains(strings.ToLower(respErr.Message), "token")
+}
+
+// commit reports rejected rows and moves checkpoint to the last line of chunk.
+func (imp *importer) commit(res *chunkResult) error {
+	for _, r := range res.chunk.rejected {
+		if err := imp.rejects.write(r.line, r.input, r.err); err != nil {
+			return err
+		}
+	}
+
+	imp.cp.Rejected += len(res.chunk.rejected)
+
+	if res.err != nil {
+		for _, r := range res.chunk.rows {
+			if err := imp.rejects.write(r.line, r.input, res.err); err != nil {
+				return err
+			}
+		}
+
+		imp.cp.Rejected += len(res.chunk.rows)
+	} else {
+		imp.cp.Imported += len(res.chunk.rows)
+	}
+
+	imp.cp.Line = res.chunk.last
+	imp.consumed = res.chunk.read
+
+	return imp.cp.save()
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+)
+
+func TestImport_resume(t *testing.T) {
+	emulator := ingestiontest.NewEmulator(ingestiontest.WithProjectToken("token"))
+
+	var requests, failing int32 = 0, 1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 && atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		emulator.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	lines := []string{}
+
+	for i := 1; i <= 120; i++ {
+		switch i {
+		case 5:
+			lines = append(lines, "not json")
+		case 70:
+			lines = append(lines, `{"properties":{"distinct_id":"u1"}}`)
+		default:
+			lines = append(lines, fmt.Sprintf(`{"event":"e%d","properties":{"distinct_id":"u1"}}`, i))
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"import", "-server", server.URL, "-token", "token", "-workers", "1", "-f", path}
+
+	e, _ := testEnv(nil, "")
+	if code := run(context.Background(), args, e); code != exitUnavailable {
+		t.Fatalf("expected exit code: %d, actual: %d, stderr: %s", exitUnavailable, code, e.stderr)
+	}
+
+	if events := emulator.Events(); len(events) != 50 {
+		t.Fatalf("unexpected number of events before resume: %d", len(events))
+	}
+
+	atomic.StoreInt32(&failing, 0)
+
+	e, _ = testEnv(nil, "")
+	// rejected rows fail import
+	if code := run(context.Background(), append(args, "-workers", "3"), e); code != exitFailure {
+		t.Fatalf("expected exit code: %d, actual: %d, stderr: %s", exitFailure, code, e.stderr)
+	}
+
+	if events := emulator.Events(); len(events) != 118 {
+		t.Fatalf("unexpected number of events after resume: %d", len(events))
+	}
+
+	if rejected := readRejects(t, path+".rejects.ndjson"); !reflect.DeepEqual(rejected, []int{5, 70}) {
+		t.Fatalf("unexpected rejected lines: %v", rejected)
+	}
+
+	cp, err := loadCheckpoint(path+".checkpoint", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cp.Line != 120 || cp.Imported != 118 || cp.Rejected != 2 {
+		t.Fatalf("unexpected checkpoint: %+v", cp)
+	}
+}
+
+func TestImport_request_rejected(t *testing.T) {
+	emulator := httptest.NewServer(ingestiontest.NewEmulator(ingestiontest.WithProjectToken("token")))
+	defer emulator.Close()
+
+	unauthorized := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"status":"error","error":"Invalid credentials"}`))
+	}))
+	defer unauthorized.Close()
+
+	lines := []string{}
+	for i := 1; i <= 60; i++ {
+		lines = append(lines, fmt.Sprintf(`{"event":"e%d","properties":{"distinct_id":"u1"}}`, i))
+	}
+
+	for i, server := range []string{emulator.URL, unauthorized.URL} {
+		path := filepath.Join(t.TempDir(), "events.ndjson")
+		if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		e, _ := testEnv(nil, "")
+		args := []string{"import", "-server", server, "-token", "wrong", "-workers", "1", "-f", path}
+
+		if code := run(context.Background(), args, e); code != exitRejected {
+			t.Fatalf("[#%d] expected exit code: %d, actual: %d, stderr: %s", i, exitRejected, code, e.stderr)
+		}
+
+		if rejected := readRejects(t, path+".rejects.ndjson"); len(rejected) != 0 {
+			t.Fatalf("[#%d] unexpected rejected lines: %v", i, rejected)
+		}
+
+		cp, err := loadCheckpoint(path+".checkpoint", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if cp.Line != 0 || cp.Imported != 0 || cp.Rejected != 0 {
+			t.Fatalf("[#%d] unexpected checkpoint: %+v", i, cp)
+		}
+	}
+}
+
+func readRejects(t *testing.T, path string) []int {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines := []int{}
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		r := rejection{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+
+		lines = append(lines, r.Line)
+	}
+
+	return lines
+}
+
+func TestImport_csv_mapping(t *testing.T) {
+	emulator := ingestiontest.NewEmulator()
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "orders.csv")
+	mapping := filepath.Join(dir, "mapping.json")
+
+	csv := "action,user,amount,paid,at,note\n" +
+		"purchase,u1,9.99,true,2021-01-02T03:04:05Z,\"multi\nline\"\n" +
+		"purchase,u2,free,false,1609556645,\n" +
+		"refund,u1,1,false,1609556645,x\n"
+	if err := ioutil.WriteFile(input, []byte(csv), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := ioutil.WriteFile(mapping, []byte(`{
+		"event": "action",
+		"properties": {"distinct_id": "user", "amount": "amount", "paid": "paid", "time": "at", "note": "note"},
+		"types": {"amount": "number", "paid": "boolean", "time": "time", "note": "string"}
+	}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ := testEnv(nil, "")
+
+	code := run(context.Background(), []string{"import", "-server", server.URL, "-f", input, "-mapping", mapping}, e)
+	if code != exitFailure {
+		t.Fatalf("unexpected exit code: %d, stderr: %s", code, e.stderr)
+	}
+
+	events := emulator.Events()
+	if len(events) != 2 || events[0].Properties.DistinctID != "u1" || events[1].Event != "refund" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	expected := map[string]interface{}{"amount": 9.99, "paid": true, "note": "multi\nline"}
+	if actual := map[string]interface{}(events[0].Properties.CustomProperties); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected properties: %v, actual: %v", expected, actual)
+	}
+
+	if events[0].Properties.Time.Unix() != 1609556645 || events[0].Properties.InsertID == "" {
+		t.Fatalf("unexpected reserved properties: %+v", events[0].Properties)
+	}
+
+	if rejected := readRejects(t, input+".rejects.ndjson"); !reflect.DeepEqual(rejected, []int{4}) {
+		t.Fatalf("unexpected rejected lines: %v", rejected)
+	}
+}
+
+func TestImport_progress(t *testing.T) {
+	server := httptest.NewServer(ingestiontest.NewEmulator())
+	defer server.Close()
+
+	cases := []struct {
+		args     []string
+		expected bool
+	}{
+		{nil, false},
+		{[]string{"-progress"}, true},
+	}
+
+	for i, c := range cases {
+		path := filepath.Join(t.TempDir(), "events.ndjson")
+		if err := ioutil.WriteFile(path, []byte(`{"event":"e"}`), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		// stderr of test environment is not terminal
+		e, _ := testEnv(nil, "")
+		args := append([]string{"import", "-server", server.URL, "-f", path}, c.args...)
+
+		if code := run(context.Background(), args, e); code != exitOK {
+			t.Fatalf("[#%d] unexpected exit code: %d, stderr: %s", i, code, e.stderr)
+		}
+
+		if actual := strings.Contains(fmt.Sprint(e.stderr), "\r"); actual != c.expected {
+			t.Fatalf("[#%d] expected progress bar: %v, actual: %v", i, c.expected, actual)
+		}
+	}
+}
+
+func TestCSVSource_lines(t *testing.T) {
+	input := "\nevent,user\n\na,u1\n\n\nb,\"multi\nline\"\n\nc,u3\r\n\r\n\"d,u4\nlast,u5"
+
+	src, err := newCSVSource(strings.NewReader(input), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := []int{}
+
+	for {
+		r, err := src.next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lines = append(lines, r.line)
+	}
+
+	// quoted field of line 12 is not closed
+	if expected := []int{4, 7, 10, 12}; !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("expected lines: %v, actual: %v", expected, lines)
+	}
+}
@@ -0,0 +1,316 @@
+// Command mixpanel sends events and profile updates to Mixpanel Ingestion API.
+//
+// Usage:
+//
+//	mixpanel <command> [flags] [args]
+//
+// Commands:
+//
+//	track        track single event
+//	track-batch  track events from JSON array or NDJSON file
+//	import       import events from NDJSON or CSV file with checkpoint to resume
+//	engage       update user profile
+//	validate     lint NDJSON events or engage objects offline
+//	serve        run local emulator or inspector forwarding requests to Mixpanel
+//
+// Project token, region and server are taken from flags or from
+// MIXPANEL_TOKEN, MIXPANEL_REGION and MIXPANEL_SERVER environment variables.
+// With -dry-run flag the command prints requests instead of sending them.
+//
+// Exit codes:
+//
+//	0  success
+//	1  failure, e.g. invalid input or validation errors
+//	2  usage error
+//	3  request is rejected by Mixpanel
+//	4  Mixpanel is unavailable or overloaded, retry may succeed
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+)
+
+// Exit codes.
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitRejected    = 3
+	exitUnavailable = 4
+)
+
+// regions maps Mixpanel data residency regions to server URLs.
+var regions = map[string]string{
+	"us": "https://api.mixpanel.com",
+	"eu": "https://api-eu.mixpanel.com",
+	"in": "https://api-in.mixpanel.com",
+}
+
+const usage = `Usage: mixpanel <command> [flags] [args]
+
+Commands:
+  track        track single event
+  track-batch  track events from JSON array or NDJSON file
+  import       import events from NDJSON or CSV file with checkpoint to resume
+  engage       update user profile
+  validate     lint NDJSON events or engage objects offline
+  serve        run local emulator or inspector forwarding requests to Mixpanel
+
+Run 'mixpanel <command> -h' for command flags.
+`
+
+// env provides environment of the command.
+type env struct {
+	getenv func(string) string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command func(ctx context.Context, e *env, args []string) error
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], &env{getenv: os.Getenv, stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr})
+
+	stop()
+	os.Exit(code)
+}
+
+// run executes command and returns exit code.
+func run(ctx context.Context, args []string, e *env) int {
+	commands := map[string]command{
+		"track":       runTrack,
+		"track-batch": runTrackBatch,
+		"import":      runImport,
+		"engage":      runEngage,
+		"validate":    runValidate,
+		"serve":       runServe,
+	}
+
+	if len(args) == 0 {
+		fmt.Fprint(e.stderr, usage)
+
+		return exitUsage
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		switch args[0] {
+		case "-h", "-help", "help":
+			fmt.Fprint(e.stdout, usage)
+
+			return exitOK
+		}
+
+		fmt.Fprintf(e.stderr, "unknown command %q\n\n%s", args[0], usage)
+
+		return exitUsage
+	}
+
+	err := cmd(ctx, e, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+
+	if err != nil {
+		fmt.Fprintf(e.stderr, "mixpanel %s: %s\n", args[0], err)
+	}
+
+	return exitCode(err)
+}
+
+// usageError is returned for invalid command line.
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &usageError{err: fmt.Errorf(format, args...)}
+}
+
+// exitCode classifies errors returned by commands and the client.
+func exitCode(err error) int {
+	var (
+		usageErr *usageError
+		respErr  *ingestion.ResponseError
+		netErr   net.Error
+	)
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.As(err, &respErr):
+		if respErr.Temporary() {
+			return exitUnavailable
+		}
+
+		return exitRejected
+	case errors.Is(err, ingestion.ErrCircuitOpen),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &netErr):
+		return exitUnavailable
+	}
+
+	return exitFailure
+}
+
+// config contains flags common for all commands.
+type config struct {
+	token   string
+	region  string
+	server  string
+	timeout time.Duration
+	dryRun  bool
+}
+
+func (c *config) register(fs *flag.FlagSet, e *env) {
+	c.registerServer(fs, e)
+	fs.DurationVar(&c.timeout, "timeout", 10*time.Second, "request timeout")
+	fs.BoolVar(&c.dryRun, "dry-run", false, "print requests instead of sending them")
+}
+
+// registerServer registers flags of project and server only, for commands which do not send requests themselves.
+func (c *config) registerServer(fs *flag.FlagSet, e *env) {
+	region := e.getenv("MIXPANEL_REGION")
+	if region == "" {
+		region = "us"
+	}
+
+	fs.StringVar(&c.token, "token", e.getenv("MIXPANEL_TOKEN"), "project `token`, default is $MIXPANEL_TOKEN")
+	fs.StringVar(&c.region, "region", region, "data residency `region`: us, eu or in, default is $MIXPANEL_REGION or us")
+	fs.StringVar(&c.server, "server", e.getenv("MIXPANEL_SERVER"),
+		"server `URL` overrides region, default is $MIXPANEL_SERVER")
+}
+
+// serverURL returns URL of server or region.
+func (c *config) serverURL() (string, error) {
+	if c.server != "" {
+		return c.server, nil
+	}
+
+	server, ok := regions[strings.ToLower(c.region)]
+	if !ok {
+		return "", usageErrorf("unknown region %q", c.region)
+	}
+
+	return server, nil
+}
+
+// client builds client according to common flags.
+func (c *config) client(e *env) (ingestion.Client, error) {
+	server, err := c.serverURL()
+	if err != nil {
+		return nil, err
+	}
+
+	options := []ingestion.ClientOption{}
+	if c.dryRun {
+		options = append(options, ingestion.WithHTTPDoer(&dryRun{out: e.stdout}))
+	}
+
+	cli, err := ingestion.NewClient(server, options...)
+	if err != nil {
+		return nil, usageErrorf("%s", err)
+	}
+
+	return cli, nil
+}
+
+// context returns context limited with timeout flag.
+func (c *config) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// parseFlags parses command flags and wraps parsing error as usage error.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+
+		return &usageError{err: err}
+	}
+
+	return nil
+}
+
+// newFlagSet builds flag set which reports errors to stderr.
+func newFlagSet(name, args string, e *env) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: mixpanel %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+
+	return fs
+}
+
+// dryRun is HTTPDoer which prints URL and form body of requests exactly as they would be posted
+// and responds with success. Fragment of URL names the operation and is not posted, so it is omitted.
+type dryRun struct {
+	out io.Writer
+}
+
+func (d *dryRun) Do(req *http.Request) (*http.Response, error) {
+	target := *req.URL
+	target.Fragment = ""
+
+	payload := []byte{}
+
+	if req.Body != nil {
+		var err error
+
+		payload, err = ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+
+		if err != nil {
+			return nil, fmt.Errorf("read request: %w", err)
+		}
+	}
+
+	fmt.Fprintf(d.out, "%s %s\n%s\n\n", req.Method, target.String(), payload)
+
+	body := `{"status":1}`
+
+	return &http.Response{
+		Request:       req,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		ContentLength: int64(len(body)),
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
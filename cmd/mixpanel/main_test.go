@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+)
+
+func testEnv(vars map[string]string, stdin string) (*env, *bytes.Buffer) {
+	stdout := &bytes.Buffer{}
+
+	return &env{
+		getenv: func(name string) string { return vars[name] },
+		stdin:  strings.NewReader(stdin),
+		stdout: stdout,
+		stderr: &bytes.Buffer{},
+	}, stdout
+}
+
+func TestRun_exit_codes(t *testing.T) {
+	emulator := ingestiontest.NewEmulator(ingestiontest.WithProjectToken("token"))
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+
+	cases := []struct {
+		args     []string
+		vars     map[string]string
+		stdin    string
+		expected int
+	}{
+		{[]string{}, nil, "", exitUsage},
+		{[]string{"unknown"}, nil, "", exitUsage},
+		{[]string{"track", "-event", "e", "-region", "mars"}, nil, "", exitUsage},
+		{[]string{"track", "-distinct-id", "u1"}, nil, "", exitUsage},
+		{[]string{"track", "-event", "e", "-p", "=1"}, nil, "", exitUsage},
+		{[]string{"track", "-event", "e", "-deduplicate"}, nil, "", exitUsage},
+		{
+			[]string{"track", "-event", "e", "-deduplicate", "-p", "$insert_id=e1"},
+			map[string]string{"MIXPANEL_SERVER": server.URL, "MIXPANEL_TOKEN": "token"},
+			"",
+			exitOK,
+		},
+		{
+			[]string{"track", "-event", "e", "-p", "plan=pro"},
+			map[string]string{"MIXPANEL_SERVER": server.URL, "MIXPANEL_TOKEN": "token"},
+			"",
+			exitOK,
+		},
+		{
+			[]string{"track", "-event", "e", "-token", "wrong"},
+			map[string]string{"MIXPANEL_SERVER": server.URL},
+			"",
+			exitRejected,
+		},
+		{
+			[]string{"track", "-event", "e", "-server", unavailable.URL},
+			nil,
+			"",
+			exitUnavailable,
+		},
+		{
+			[]string{"track-batch", "-server", server.URL, "-token", "token"},
+			nil,
+			`{"event":"a"}` + "\n" + `{"event":"b","properties":{"distinct_id":"u1"}}`,
+			exitOK,
+		},
+		{[]string{"track-batch", "-server", server.URL}, nil, `[{"event":"a"}`, exitFailure},
+		{
+			[]string{"engage", "-server", server.URL, "-token", "token", "-distinct-id", "u1", "-p", "plan=pro"},
+			nil,
+			"",
+			exitOK,
+		},
+		{
+			[]string{"engage", "-server", server.URL, "-token", "token", "-distinct-id", "u1", "-op", "unset", "plan"},
+			nil,
+			"",
+			exitOK,
+		},
+		{[]string{"engage", "-distinct-id", "u1", "-op", "add"}, nil, "", exitUsage},
+	}
+
+	for i, c := range cases {
+		e, _ := testEnv(c.vars, c.stdin)
+		if actual := run(context.Background(), c.args, e); actual != c.expected {
+			t.Fatalf("[#%d] expected exit code: %d, actual: %d, stderr: %s", i, c.expected, actual, e.stderr)
+		}
+	}
+
+	if events := emulator.Events(); len(events) != 4 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	if properties, ok := emulator.Profile("u1"); !ok || len(properties) != 0 {
+		t.Fatalf("unexpected profile: %v", properties)
+	}
+}
+
+func TestRun_dry_run(t *testing.T) {
+	e, stdout := testEnv(map[string]string{"MIXPANEL_TOKEN": "token", "MIXPANEL_REGION": "eu"}, "")
+
+	args := []string{"track", "-dry-run", "-event", "signup", "-distinct-id", "u1", "-p", "seats=3"}
+	if code := run(context.Background(), args, e); code != exitOK {
+		t.Fatalf("unexpected exit code: %d", code)
+	}
+
+	expected := "POST https://api-eu.mixpanel.com/track\n" +
+		"data=" + url.QueryEscape(`{"event":"signup","properties":{"distinct_id":"u1","seats":3,"token":"token"}}`) +
+		"&verbose=1\n\n"
+	if stdout.String() != expected {
+		t.Fatalf("expected output:\n%s\nactual:\n%s", expected, stdout)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"strings"
+)
+
+// propertyFlags collects properties from repeatable `-p name=value` flags and `-props` JSON object.
+type propertyFlags struct {
+	pairs  []string
+	object string
+}
+
+func (p *propertyFlags) register(fs *flag.FlagSet) {
+	fs.Var((*pairsValue)(&p.pairs), "p",
+		"property as `name=value`, value is parsed as JSON if possible, otherwise it is string; repeatable")
+	fs.StringVar(&p.object, "props", "", "properties as JSON `object`, -p flags take precedence")
+}
+
+// parse returns collected properties, it never returns nil map.
+func (p *propertyFlags) parse() (map[string]interface{}, error) {
+	properties := map[string]interface{}{}
+
+	if p.object != "" {
+		if err := json.Unmarshal([]byte(p.object), &properties); err != nil {
+			return nil, usageErrorf("invalid -props: %s", err)
+		}
+
+		if properties == nil {
+			properties = map[string]interface{}{}
+		}
+	}
+
+	for _, pair := range p.pairs {
+		name, value := pair, ""
+		if i := strings.Index(pair, "="); i >= 0 {
+			name, value = pair[:i], pair[i+1:]
+		}
+
+		if name == "" {
+			return nil, usageErrorf("invalid -p %q: property name is empty", pair)
+		}
+
+		properties[name] = parseValue(value)
+	}
+
+	return properties, nil
+}
+
+// parseValue decodes JSON value, e.g. number, boolean or quoted string, or returns raw string.
+func parseValue(raw string) interface{} {
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return raw
+	}
+
+	return value
+}
+
+// pairsValue implements flag.Value for repeatable flag.
+type pairsValue []string
+
+func (v *pairsValue) String() string {
+	if v == nil {
+		return ""
+	}
+
+	return strings.Join(*v, ", ")
+}
+
+func (v *pairsValue) Set(value string) error {
+	*v = append(*v, value)
+
+	return nil
+}
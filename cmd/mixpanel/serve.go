@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/internal/form"
+)
+
+// profileOperations maps profile operations to fragments of OpenAPI paths.
+var profileOperations = map[string]string{
+	"$set":      "profile-set",
+	"$set_once": "profile-set-once",
+	"$add":      "profile-numerical-add",
+	"$append":   "profile-list-append",
+	"$remove":   "profile-list-remove",
+	"$unset":    "profile-unset",
+	"$delete":   "profile-delete",
+}
+
+// inspection is log entry of decoded item.
+type inspection struct {
+	Time     time.Time       `json:"time"`
+	Method   string          `json:"method"`
+	Endpoint string          `json:"endpoint"`
+	Item     json.RawMessage `json:"item,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// inspector logs decoded events and profile updates, optionally validates them,
+// and passes requests to the next handler, e.g. emulator or reverse proxy to Mixpanel.
+type inspector struct {
+	next      http.Handler
+	validator *ingestiontest.OpenAPIValidator
+	json      bool
+
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (i *inspector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Requested-With")
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	values, err := requestValues(r)
+	if err != nil {
+		i.log(&inspection{Method: r.Method, Endpoint: r.URL.Path, Error: err.Error()})
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	items, batch, err := form.DecodeItems(values.Get("data"))
+	if err != nil {
+		i.log(&inspection{Method: r.Method, Endpoint: r.URL.Path, Error: err.Error()})
+		i.next.ServeHTTP(w, r)
+
+		return
+	}
+
+	if err := i.validate(r.URL.Path, values, items, batch); err != nil {
+		i.log(&inspection{Method: r.Method, Endpoint: r.URL.Path, Error: err.Error()})
+		respondFailure(w, values, err)
+
+		return
+	}
+
+	for _, item := range items {
+		i.log(&inspection{Method: r.Method, Endpoint: r.URL.Path, Item: item})
+	}
+
+	i.next.ServeHTTP(w, r)
+}
+
+// requestValues returns query and form values, request body is kept for the next handler.
+func requestValues(r *http.Request) (url.Values, error) {
+	values := r.URL.Query()
+
+	if r.Body == nil {
+		return values, nil
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	_ = r.Body.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("read request: %w", err)
+	}
+
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	posted, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("parse request form: %w", err)
+	}
+
+	for name := range posted {
+		values.Set(name, posted.Get(name))
+	}
+
+	return values, nil
+}
+
+// validate checks items against OpenAPI specification as if they were sent by ingestion.Client.
+func (i *inspector) validate(path string, values url.Values, items []json.RawMessage, batch bool) error {
+	if i.validator == nil {
+		return nil
+	}
+
+	fragment, err := operationFragment(path, items, batch)
+	if err != nil {
+		return err
+	}
+
+	data := items[0]
+	if batch {
+		data, _ = json.Marshal(items)
+	}
+
+	posted := url.Values{"data": []string{string(data)}}
+
+	for _, name := range []string{"ip", "verbose"} {
+		if v := values.Get(name); v != "" {
+			posted.Set(name, v)
+		}
+	}
+
+	req, err := http.NewRequest(
+		http.MethodPost,
+		"https://api.mixpanel.com"+strings.TrimSuffix(path, "/")+"#"+fragment,
+		strings.NewReader(posted.Encode()),
+	)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := i.validator.Do(req)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// operationFragment detects operation of OpenAPI specification.
+func operationFragment(path string, items []json.RawMessage, batch bool) (string, error) {
+	switch strings.TrimSuffix(path, "/") {
+	case "/track":
+		if batch {
+			return "past-events-batch", nil
+		}
+
+		return "live-event", nil
+	case "/engage":
+		if batch {
+			return "profile-batch-update", nil
+		}
+
+		action := map[string]json.RawMessage{}
+		if err := json.Unmarshal(items[0], &action); err != nil {
+			return "", fmt.Errorf("invalid profile action: %w", err)
+		}
+
+		for op, fragment := range profileOperations {
+			if _, ok := action[op]; ok {
+				return fragment, nil
+			}
+		}
+
+		return "", fmt.Errorf("unsupported profile operation")
+	}
+
+	return "", fmt.Errorf("unknown endpoint %s", path)
+}
+
+// respondFailure responds like Mixpanel to invalid data.
+func respondFailure(w http.ResponseWriter, values url.Values, err error) {
+	if values.Get("verbose") != "1" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, "0")
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"status": 0, "error": err.Error()})
+}
+
+func (i *inspector) log(entry *inspection) {
+	entry.Time = time.Now()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.json {
+		_ = json.NewEncoder(i.out).Encode(entry)
+
+		return
+	}
+
+	fmt.Fprintf(i.out, "%s %s %s %s\n", entry.Time.Format("15:04:05.000"), entry.Method, entry.Endpoint, describe(entry))
+}
+
+// describe formats entry to read by human.
+func describe(entry *inspection) string {
+	if entry.Error != "" {
+		return "error: " + entry.Error
+	}
+
+	item := map[string]json.RawMessage{}
+	if err := json.Unmarshal(entry.Item, &item); err != nil {
+		return string(entry.Item)
+	}
+
+	if name, ok := item["event"]; ok {
+		return fmt.Sprintf("event %s properties=%s", name, item["properties"])
+	}
+
+	ops := []string{}
+
+	for key, value := range item {
+		if key != "$token" && key != "$distinct_id" {
+			ops = append(ops, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+
+	sort.Strings(ops)
+
+	return fmt.Sprintf("profile %s %s", item["$distinct_id"], strings.Join(ops, " "))
+}
+
+// newForwarder builds reverse proxy to Mixpanel server, CORS headers of Mixpanel are replaced by inspector ones.
+func newForwarder(server string) (http.Handler, error) {
+	target, err := url.Parse(server)
+	if err != nil {
+		return nil, usageErrorf("invalid server URL: %s", err)
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = target.Host
+	}
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		for name := range resp.Header {
+			if strings.HasPrefix(name, "Access-Control-") {
+				resp.Header.Del(name)
+			}
+		}
+
+		return nil
+	}
+
+	return proxy, nil
+}
+
+func runServe(ctx context.Context, e *env, args []string) error {
+	var (
+		cfg               config
+		addr, output      string
+		validate, forward bool
+	)
+
+	fs := newFlagSet("serve", "", e)
+	cfg.registerServer(fs, e)
+	fs.StringVar(&addr, "addr", "localhost:8080", "`address` to listen")
+	fs.StringVar(&output, "output", "text", "log `format`: text or json")
+	fs.BoolVar(&validate, "validate", false, "validate requests against OpenAPI specification of Ingestion API")
+	fs.BoolVar(&forward, "forward", false, "forward requests to Mixpanel server instead of local emulator")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	handler, err := newServeHandler(&cfg, e.stdout, output, validate, forward)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	served := make(chan error, 1)
+
+	go func() {
+		served <- server.Serve(listener)
+	}()
+
+	fmt.Fprintf(e.stderr, "listening on http://%s\n", listener.Addr())
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := server.Shutdown(shutdown); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// newServeHandler builds inspector of emulator or forwarder.
+func newServeHandler(cfg *config, out io.Writer, output string, validate, forward bool) (http.Handler, error) {
+	if output != "text" && output != "json" {
+		return nil, usageErrorf("unknown output format %q", output)
+	}
+
+	i := &inspector{out: out, json: output == "json"}
+
+	if forward {
+		server, err := cfg.serverURL()
+		if err != nil {
+			return nil, err
+		}
+
+		if i.next, err = newForwarder(server); err != nil {
+			return nil, err
+		}
+	} else {
+		options := []ingestiontest.EmulatorOption{}
+		if cfg.token != "" {
+			options = append(options, ingestiontest.WithProjectToken(cfg.token))
+		}
+
+		i.next = ingestiontest.NewEmulator(options...)
+	}
+
+	if validate {
+		var err error
+		if i.validator, err = ingestiontest.NewOpenAPIValidator(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return i, nil
+}
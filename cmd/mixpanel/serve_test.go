@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+)
+
+func TestServe_inspector(t *testing.T) {
+	log := &bytes.Buffer{}
+
+	handler, err := newServeHandler(&config{token: "token"}, log, "json", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	args := [][]string{
+		{"track", "-server", server.URL, "-token", "token", "-event", "signup", "-distinct-id", "u1"},
+		{"engage", "-server", server.URL, "-token", "token", "-distinct-id", "u1", "-p", "plan=pro"},
+		{"track", "-server", server.URL, "-token", "wrong", "-event", "signup"},
+	}
+	expected := []int{exitOK, exitOK, exitRejected}
+
+	for i := range args {
+		e, _ := testEnv(nil, "")
+		if code := run(context.Background(), args[i], e); code != expected[i] {
+			t.Fatalf("[#%d] expected exit code: %d, actual: %d, stderr: %s", i, expected[i], code, e.stderr)
+		}
+	}
+
+	// official SDKs send base64-encoded data with GET requests
+	data := base64.StdEncoding.EncodeToString([]byte(`[{"event":"page","properties":{"token":"token"}}]`))
+
+	resp, err := http.Get(server.URL + "/track/?data=" + url.QueryEscape(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = resp.Body.Close()
+
+	resp, err = http.PostForm(server.URL+"/track", url.Values{
+		"data":    []string{`{"event":"bad","properties":{"token":"token","time":"now"}}`},
+		"verbose": []string{"1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if !strings.Contains(string(body), `"status":0`) {
+		t.Fatalf("unexpected response to invalid event: %s", body)
+	}
+
+	actual := []string{}
+	scanner := bufio.NewScanner(log)
+
+	for scanner.Scan() {
+		entry := inspection{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+
+		summary := entry.Endpoint + " " + string(entry.Item)
+		if entry.Error != "" {
+			summary = entry.Endpoint + " error"
+		}
+
+		actual = append(actual, summary)
+	}
+
+	if len(actual) != 5 ||
+		!strings.Contains(actual[0], `"event":"signup"`) ||
+		!strings.Contains(actual[1], `"$set":{"plan":"pro"}`) ||
+		!strings.Contains(actual[2], `"token":"wrong"`) ||
+		!strings.Contains(actual[3], `"event":"page"`) ||
+		actual[4] != "/track error" {
+		t.Fatalf("unexpected log:\n%s", strings.Join(actual, "\n"))
+	}
+}
+
+func TestServe_browser_sdk(t *testing.T) {
+	log := &bytes.Buffer{}
+
+	handler, err := newServeHandler(&config{token: "token"}, log, "text", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// mixpanel-js posts base64-encoded batch with time in fractional seconds
+	data := base64.StdEncoding.EncodeToString([]byte(`[{"event":"$mp_web_page_view","properties":{` +
+		`"$current_url":"https://example.com/","mp_lib":"web","distinct_id":"$device:18b",` +
+		`"$insert_id":"r8kq3m9cz2x","token":"token","time":1700000000.123}}]`))
+
+	resp, err := http.PostForm(server.URL+"/track/?ip=1&_=1700000000456", url.Values{"data": {data}, "verbose": {"1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != `{"status":1}` {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, body)
+	}
+
+	if !strings.Contains(log.String(), `POST /track/ event "$mp_web_page_view"`) {
+		t.Fatalf("unexpected log: %s", log)
+	}
+}
+
+func TestServe_forward(t *testing.T) {
+	emulator := ingestiontest.NewEmulator()
+	upstream := httptest.NewServer(emulator)
+	defer upstream.Close()
+
+	log := &bytes.Buffer{}
+
+	handler, err := newServeHandler(&config{server: upstream.URL}, log, "text", false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	e, _ := testEnv(nil, "")
+
+	args := []string{"track", "-server", server.URL, "-token", "token", "-event", "signup", "-p", "seats=3"}
+	if code := run(context.Background(), args, e); code != exitOK {
+		t.Fatalf("unexpected exit code: %d, stderr: %s", code, e.stderr)
+	}
+
+	if events := emulator.Events(); len(events) != 1 || events[0].Event != "signup" {
+		t.Fatalf("unexpected forwarded events: %+v", events)
+	}
+
+	if !strings.Contains(log.String(), `POST /track event "signup" properties={"seats":3,"token":"token"}`) {
+		t.Fatalf("unexpected log: %s", log)
+	}
+}
+
+func TestServe_flags(t *testing.T) {
+	for i, args := range [][]string{{"serve", "-dry-run"}, {"serve", "-timeout", "1s"}} {
+		e, _ := testEnv(nil, "")
+		if actual := run(context.Background(), args, e); actual != exitUsage {
+			t.Fatalf("[#%d] expected exit code: %d, actual: %d", i, exitUsage, actual)
+		}
+	}
+}
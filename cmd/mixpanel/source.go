@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+// maxLineSize limits size of NDJSON line, Mixpanel rejects events larger than 1 MB.
+const maxLineSize = 2 << 20
+
+// row is single input record converted to event.
+type row struct {
+	line  int
+	input string
+	data  *event.Data
+	// err explains why row is rejected before sending.
+	err error
+}
+
+// source reads rows from input, returns io.EOF at the end of input.
+type source interface {
+	next() (*row, error)
+}
+
+// ndjsonSource reads events encoded as JSON objects line by line.
+type ndjsonSource struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONSource(r io.Reader) *ndjsonSource {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	return &ndjsonSource{scanner: scanner}
+}
+
+func (s *ndjsonSource) next() (*row, error) {
+	for s.scanner.Scan() {
+		s.line++
+
+		text := strings.TrimSpace(s.scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		r := &row{line: s.line, input: text, data: &event.Data{}}
+
+		switch err := json.Unmarshal([]byte(text), r.data); {
+		case err != nil:
+			r.data, r.err = nil, err
+		case r.data.Event == "":
+			r.data, r.err = nil, fmt.Errorf("event name is empty")
+		}
+
+		return r, nil
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", s.line+1, err)
+	}
+
+	return nil, io.EOF
+}
+
+// mapping describes conversion of CSV records to events.
+type mapping struct {
+	// Event is the column with event name.
+	Event string `json:"event"`
+	// Properties maps property names to columns.
+	Properties map[string]string `json:"properties"`
+	// Types maps property names to value types: auto (default), string, number, boolean, json or time.
+	// Auto values are parsed as JSON if possible, otherwise they are strings.
+	// Time values are RFC 3339 or unix timestamps and converted to unix timestamps.
+	Types map[string]string `json:"types"`
+}
+
+// loadMapping reads mapping from JSON file.
+func loadMapping(path string) (*mapping, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &mapping{}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(m); err != nil {
+		return nil, fmt.Errorf("decode mapping %s: %w", path, err)
+	}
+
+	for property, typ := range m.Types {
+		switch typ {
+		case "auto", "string", "number", "boolean", "json", "time":
+		default:
+			return nil, fmt.Errorf("mapping %s: unknown type %q of property %s", path, typ, property)
+		}
+	}
+
+	return m, nil
+}
+
+// defaultMapping maps `event` column to event name and other columns to properties with the same names.
+func defaultMapping(header []string) *mapping {
+	m := &mapping{Event: "event", Properties: map[string]string{}}
+
+	for _, column := range header {
+		if column != m.Event {
+			m.Properties[column] = column
+		}
+	}
+
+	return m
+}
+
+// event converts CSV record to event, empty cells are skipped.
+func (m *mapping) event(record []string, columns map[string]int) (*event.Data, error) {
+	name := record[columns[m.Event]]
+	if name == "" {
+		return nil, fmt.Errorf("event name is empty")
+	}
+
+	properties := map[string]interface{}{}
+
+	for property, column := range m.Properties {
+		raw := record[columns[column]]
+		if raw == "" {
+			continue
+		}
+
+		value, err := convertValue(raw, m.Types[property])
+		if err != nil {
+			return nil, fmt.Errorf("property %s: %w", property, err)
+		}
+
+		properties[property] = value
+	}
+
+	return makeEvent(name, properties)
+}
+
+func convertValue(raw, typ string) (interface{}, error) {
+	switch typ {
+	case "string":
+		return raw, nil
+	case "number":
+		return strconv.ParseFloat(raw, 64)
+	case "boolean":
+		return strconv.ParseBool(raw)
+	case "json":
+		var value interface{}
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			return nil, err
+		}
+
+		return value, nil
+	case "time":
+		t, err := parseTime(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		return t.Unix(), nil
+	}
+
+	return parseValue(raw), nil
+}
+
+// csvSource reads events from CSV with header.
+type csvSource struct {
+	reader  *csv.Reader
+	lines   *lineReader
+	mapping *mapping
+	columns map[string]int
+}
+
+// newCSVSource reads CSV header, default mapping is used if m is nil.
+func newCSVSource(r io.Reader, m *mapping) (*csvSource, error) {
+	lines := &lineReader{r: bufio.NewReader(r)}
+	reader := csv.NewReader(lines)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, column := range header {
+		columns[column] = i
+	}
+
+	if m == nil {
+		m = defaultMapping(header)
+	}
+
+	for _, column := range append([]string{m.Event}, mappedColumns(m)...) {
+		if _, ok := columns[column]; !ok {
+			return nil, fmt.Errorf("CSV column %q is not found", column)
+		}
+	}
+
+	return &csvSource{reader: reader, lines: lines, mapping: m, columns: columns}, nil
+}
+
+func mappedColumns(m *mapping) []string {
+	columns := make([]string, 0, len(m.Properties))
+	for _, column := range m.Properties {
+		columns = append(columns, column)
+	}
+
+	return columns
+}
+
+func (s *csvSource) next() (*row, error) {
+	record, err := s.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &row{line: parseErr.StartLine, err: parseErr.Err}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// record ends at the last line read, quoted fields may contain line breaks
+	r := &row{line: s.lines.last() - strings.Count(strings.Join(record, ""), "\n"), input: encodeRecord(record)}
+
+	if r.data, err = s.mapping.event(record, s.columns); err != nil {
+		r.err = err
+	}
+
+	return r, nil
+}
+
+// lineReader passes input to csv.Reader line by line and counts lines,
+// so csv.Reader does not read ahead and lines of records are known even if blank lines are skipped.
+type lineReader struct {
+	r    *bufio.Reader
+	rest []byte
+	// lines is the number of complete lines read, partial is true if part of the next line is read.
+	lines   int
+	partial bool
+}
+
+func (l *lineReader) Read(p []byte) (int, error) {
+	if len(l.rest) == 0 {
+		line, err := l.r.ReadSlice('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+
+		l.rest = line
+	}
+
+	n := copy(p, l.rest)
+	l.rest = l.rest[n:]
+	l.lines += bytes.Count(p[:n], []byte("\n"))
+	l.partial = p[n-1] != '\n'
+
+	return n, nil
+}
+
+// last returns number of the last line read.
+func (l *lineReader) last() int {
+	if l.partial {
+		return l.lines + 1
+	}
+
+	return l.lines
+}
+
+func encodeRecord(record []string) string {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	_ = w.Write(record)
+	w.Flush()
+
+	return strings.TrimRight(buf.String(), "\n")
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+// trackFlags describes single event.
+type trackFlags struct {
+	name        string
+	distinctID  string
+	insertID    string
+	ip          string
+	time        string
+	deduplicate bool
+	properties  propertyFlags
+}
+
+func (f *trackFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.name, "event", "", "event `name`, required")
+	fs.StringVar(&f.distinctID, "distinct-id", "", "distinct `ID` of user")
+	fs.StringVar(&f.insertID, "insert-id", "", "`ID` to deduplicate event")
+	fs.StringVar(&f.ip, "ip", "", "IP `address` to add geolocation data")
+	fs.StringVar(&f.time, "time", "", "event `time` as RFC 3339 or unix timestamp, default is arrival time")
+	fs.BoolVar(
+		&f.deduplicate, "deduplicate", false, "use deduplicate endpoint, requires -insert-id or $insert_id property",
+	)
+	f.properties.register(fs)
+}
+
+// event builds event from flags, dedicated flags take precedence over properties.
+func (f *trackFlags) event(token string) (*event.Data, error) {
+	if f.name == "" {
+		return nil, usageErrorf("-event is required")
+	}
+
+	properties, err := f.properties.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := makeEvent(f.name, properties)
+	if err != nil {
+		return nil, usageErrorf("invalid properties: %s", err)
+	}
+
+	if f.time != "" {
+		if data.Properties.Time, err = parseTime(f.time); err != nil {
+			return nil, usageErrorf("invalid -time: %s", err)
+		}
+	}
+
+	for _, field := range []struct {
+		value  string
+		target *string
+	}{
+		{f.distinctID, &data.Properties.DistinctID},
+		{f.insertID, &data.Properties.InsertID},
+		{f.ip, &data.Properties.IP},
+		{token, &data.Properties.Token},
+	} {
+		if field.value != "" {
+			*field.target = field.value
+		}
+	}
+
+	if f.deduplicate && data.Properties.InsertID == "" {
+		return nil, usageErrorf("-deduplicate requires -insert-id or $insert_id property")
+	}
+
+	return data, nil
+}
+
+// makeEvent builds event with properties, reserved properties like `distinct_id` are decoded into dedicated fields.
+func makeEvent(name string, properties map[string]interface{}) (*event.Data, error) {
+	raw, err := json.Marshal(properties)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &event.Data{Event: name}
+	if err := json.Unmarshal(raw, &data.Properties); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// parseTime parses RFC 3339 time or unix timestamp in seconds.
+func parseTime(value string) (time.Time, error) {
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(unix, 0).UTC(), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+func runTrack(ctx context.Context, e *env, args []string) error {
+	var (
+		cfg   config
+		track trackFlags
+	)
+
+	fs := newFlagSet("track", "", e)
+	cfg.register(fs, e)
+	track.register(fs)
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	data, err := track.event(cfg.token)
+	if err != nil {
+		return err
+	}
+
+	cli, err := cfg.client(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := cfg.context(ctx)
+	defer cancel()
+
+	if track.deduplicate {
+		return cli.TrackDeduplicate(ctx, data)
+	}
+
+	return cli.Track(ctx, data)
+}
+
+func runTrackBatch(ctx context.Context, e *env, args []string) error {
+	var (
+		cfg  config
+		path string
+	)
+
+	fs := newFlagSet("track-batch", "", e)
+	cfg.register(fs, e)
+	fs.StringVar(&path, "f", "-", "`file` with JSON array or NDJSON of events, - is stdin")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	events, err := readEvents(path, e.stdin)
+	if err != nil {
+		return err
+	}
+
+	for _, data := range events {
+		if cfg.token != "" && data.Properties.Token == "" {
+			data.Properties.Token = cfg.token
+		}
+	}
+
+	cli, err := cfg.client(e)
+	if err != nil {
+		return err
+	}
+
+	for from := 0; from < len(events); from += ingestion.TrackBatchLimit {
+		to := from + ingestion.TrackBatchLimit
+		if to > len(events) {
+			to = len(events)
+		}
+
+		if err := trackBatch(ctx, &cfg, cli, events[from:to]); err != nil {
+			return fmt.Errorf("events %d-%d (%d tracked): %w", from+1, to, from, err)
+		}
+	}
+
+	fmt.Fprintf(e.stderr, "%d events tracked\n", len(events))
+
+	return nil
+}
+
+func trackBatch(ctx context.Context, cfg *config, cli ingestion.Client, batch []*event.Data) error {
+	ctx, cancel := cfg.context(ctx)
+	defer cancel()
+
+	return cli.TrackBatch(ctx, batch)
+}
+
+// readEvents reads events from file or stdin.
+func readEvents(path string, stdin io.Reader) ([]*event.Data, error) {
+	r := stdin
+
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	events, err := decodeEvents(r)
+	if err != nil {
+		return nil, fmt.Errorf("read events from %s: %w", path, err)
+	}
+
+	if len(events) == 0 {
+		return nil, fmt.Errorf("no events in %s", path)
+	}
+
+	for i, data := range events {
+		if data == nil {
+			return nil, fmt.Errorf("event #%d in %s is null", i+1, path)
+		}
+	}
+
+	return events, nil
+}
+
+// decodeEvents decodes JSON array of events or stream of JSON objects, e.g. NDJSON.
+func decodeEvents(r io.Reader) ([]*event.Data, error) {
+	reader := bufio.NewReader(r)
+
+	first, err := peekNonSpace(reader)
+	if err == io.EOF {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(reader)
+	events := []*event.Data{}
+
+	if first == '[' {
+		if err := decoder.Decode(&events); err != nil {
+			return nil, err
+		}
+
+		return events, nil
+	}
+
+	for {
+		data := &event.Data{}
+
+		err := decoder.Decode(data)
+		if err == io.EOF {
+			return events, nil
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("event #%d: %w", len(events)+1, err)
+		}
+
+		events = append(events, data)
+	}
+}
+
+// peekNonSpace skips leading white space and returns next byte without consuming it.
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+
+		return b, r.UnreadByte()
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	jsonschema "github.com/santhosh-tekuri/jsonschema/v3"
+	"github.com/wtask-go/mixpanel/internal/assets"
+)
+
+// Mixpanel limits of ingested data, longer values are truncated or rejected by Mixpanel.
+const (
+	maxEventSize    = 1 << 20 // bytes of JSON object
+	maxNameLength   = 255     // characters of event or property name
+	maxProperties   = 255     // properties of event
+	maxStringLength = 255     // characters of string value
+	maxListLength   = 255     // items of list value
+	maxObjectDepth  = 3       // nesting levels of object value
+	maxInsertID     = 36      // characters of $insert_id
+)
+
+var insertIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]*$`)
+
+// problem is single validation error of input line.
+type problem struct {
+	Line int `json:"line"`
+	// Path is JSON pointer to invalid value.
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// validator checks events and engage objects against embedded JSON schemas and Mixpanel limits.
+type validator struct {
+	kind   string
+	event  *jsonschema.Schema
+	engage *jsonschema.Schema
+}
+
+func newValidator(kind string) (*validator, error) {
+	switch kind {
+	case "auto", "event", "engage":
+	default:
+		return nil, usageErrorf("unknown type %q", kind)
+	}
+
+	return &validator{
+		kind:   kind,
+		event:  assets.MustCompileSchema("openapi/event.schema.json"),
+		engage: assets.MustCompileSchema("openapi/engage.schema.json"),
+	}, nil
+}
+
+// validate returns problems of JSON object.
+func (v *validator) validate(line int, raw []byte) []*problem {
+	doc, err := jsonschema.DecodeJSON(bytes.NewReader(raw))
+	if err != nil {
+		return []*problem{{Line: line, Error: fmt.Sprintf("invalid JSON: %s", err)}}
+	}
+
+	obj, ok := doc.(map[string]interface{})
+	if !ok {
+		return []*problem{{Line: line, Error: "expected JSON object"}}
+	}
+
+	kind := v.kind
+	if kind == "auto" {
+		kind = "event"
+		if _, ok := obj["event"]; !ok {
+			kind = "engage"
+		}
+	}
+
+	schema, check := v.event, checkEvent
+	if kind == "engage" {
+		schema, check = v.engage, checkEngage
+	}
+
+	problems := []*problem{}
+
+	var validationErr *jsonschema.ValidationError
+	if err := schema.ValidateInterface(doc); errors.As(err, &validationErr) {
+		problems = append(problems, schemaProblems(line, validationErr)...)
+	} else if err != nil {
+		problems = append(problems, &problem{Line: line, Error: err.Error()})
+	}
+
+	if len(raw) > maxEventSize {
+		problems = append(problems, &problem{Line: line, Error: fmt.Sprintf("size exceeds %d bytes", maxEventSize)})
+	}
+
+	for _, p := range check(obj) {
+		p.Line = line
+		problems = append(problems, p)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Path < problems[j].Path
+	})
+
+	return problems
+}
+
+// schemaProblems flattens validation error to the most specific causes,
+// failed oneOf and anyOf are reported as is, because their causes are alternatives.
+func schemaProblems(line int, err *jsonschema.ValidationError) []*problem {
+	if len(err.Causes) == 0 || strings.HasSuffix(err.SchemaPtr, "/oneOf") || strings.HasSuffix(err.SchemaPtr, "/anyOf") {
+		return []*problem{{Line: line, Path: strings.TrimPrefix(err.InstancePtr, "#"), Error: err.Message}}
+	}
+
+	problems := []*problem{}
+	for _, cause := range err.Causes {
+		problems = append(problems, schemaProblems(line, cause)...)
+	}
+
+	return problems
+}
+
+func checkEvent(obj map[string]interface{}) []*problem {
+	problems := []*problem{}
+
+	if name, ok := obj["event"].(string); ok && utf8.RuneCountInString(name) > maxNameLength {
+		problems = append(problems, &problem{Path: "/event", Error: fmt.Sprintf("name exceeds %d characters", maxNameLength)})
+	}
+
+	properties, ok := obj["properties"].(map[string]interface{})
+	if !ok {
+		return problems
+	}
+
+	if len(properties) > maxProperties {
+		problems = append(problems, &problem{
+			Path:  "/properties",
+			Error: fmt.Sprintf("%d properties exceed limit of %d", len(properties), maxProperties),
+		})
+	}
+
+	if id, ok := properties["$insert_id"].(string); ok && (len(id) > maxInsertID || !insertIDPattern.MatchString(id)) {
+		problems = append(problems, &problem{
+			Path:  "/properties/$insert_id",
+			Error: fmt.Sprintf("must contain up to %d alphanumeric characters or hyphens", maxInsertID),
+		})
+	}
+
+	return append(problems, checkObject("/properties", properties, 0)...)
+}
+
+func checkEngage(obj map[string]interface{}) []*problem {
+	problems := []*problem{}
+
+	for _, op := range []string{"$set", "$set_once", "$add", "$append", "$remove"} {
+		if values, ok := obj[op].(map[string]interface{}); ok {
+			problems = append(problems, checkObject("/"+op, values, 0)...)
+		}
+	}
+
+	if names, ok := obj["$unset"].([]interface{}); ok {
+		for i, name := range names {
+			if n, ok := name.(string); ok && utf8.RuneCountInString(n) > maxNameLength {
+				problems = append(problems, &problem{
+					Path:  fmt.Sprintf("/$unset/%d", i),
+					Error: fmt.Sprintf("name exceeds %d characters", maxNameLength),
+				})
+			}
+		}
+	}
+
+	return problems
+}
+
+// checkObject checks names and values of properties.
+func checkObject(path string, obj map[string]interface{}, depth int) []*problem {
+	problems := []*problem{}
+
+	if depth > maxObjectDepth {
+		return append(problems, &problem{Path: path, Error: fmt.Sprintf("nesting exceeds %d levels", maxObjectDepth)})
+	}
+
+	for name, value := range obj {
+		p := path + "/" + escapePointer(name)
+		if utf8.RuneCountInString(name) > maxNameLength {
+			problems = append(problems, &problem{Path: p, Error: fmt.Sprintf("name exceeds %d characters", maxNameLength)})
+		}
+
+		problems = append(problems, checkValue(p, value, depth)...)
+	}
+
+	return problems
+}
+
+func checkValue(path string, value interface{}, depth int) []*problem {
+	switch v := value.(type) {
+	case string:
+		if utf8.RuneCountInString(v) > maxStringLength {
+			return []*problem{{Path: path, Error: fmt.Sprintf("string exceeds %d characters", maxStringLength)}}
+		}
+	case []interface{}:
+		if len(v) > maxListLength {
+			return []*problem{{Path: path, Error: fmt.Sprintf("list exceeds %d items", maxListLength)}}
+		}
+
+		problems := []*problem{}
+		for i, item := range v {
+			problems = append(problems, checkValue(fmt.Sprintf("%s/%d", path, i), item, depth)...)
+		}
+
+		return problems
+	case map[string]interface{}:
+		return checkObject(path, v, depth+1)
+	}
+
+	return nil
+}
+
+// escapePointer escapes JSON pointer token.
+func escapePointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
+
+// errInvalid is returned when input contains invalid lines.
+var errInvalid = errors.New("input is invalid")
+
+func runValidate(_ context.Context, e *env, args []string) error {
+	var path, kind, output string
+
+	fs := newFlagSet("validate", "", e)
+	fs.StringVar(&path, "f", "-", "NDJSON `file` to validate, - is stdin")
+	fs.StringVar(&kind, "type", "auto", "`type` of objects: event, engage or auto to detect by `event` key")
+	fs.StringVar(&output, "output", "ndjson", "output `format`: ndjson or text")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if output != "ndjson" && output != "text" {
+		return usageErrorf("unknown output format %q", output)
+	}
+
+	v, err := newValidator(kind)
+	if err != nil {
+		return err
+	}
+
+	r := e.stdin
+
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	lines, invalid, err := v.validateLines(r, func(p *problem) {
+		if output == "text" {
+			fmt.Fprintf(e.stdout, "%s:%d: %s: %s\n", path, p.Line, p.Path, p.Error)
+
+			return
+		}
+
+		_ = json.NewEncoder(e.stdout).Encode(p)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(e.stderr, "%d lines checked, %d invalid\n", lines, invalid)
+
+	if invalid > 0 {
+		return fmt.Errorf("%w: %d of %d lines", errInvalid, invalid, lines)
+	}
+
+	return nil
+}
+
+// validateLines reports problems of NDJSON lines, empty lines are skipped.
+func (v *validator) validateLines(r io.Reader, report func(*problem)) (lines, invalid int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+
+		lines++
+
+		problems := v.validate(line, raw)
+		if len(problems) > 0 {
+			invalid++
+		}
+
+		for _, p := range problems {
+			report(p)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return lines, invalid, fmt.Errorf("line %d: %w", line+1, err)
+	}
+
+	return lines, invalid, nil
+}
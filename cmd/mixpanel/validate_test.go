@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	long := strings.Repeat("x", maxStringLength+1)
+	input := strings.Join([]string{
+		`{"event":"ok","properties":{"token":"t","time":1601412131,"list":[1,2]}}`,
+		`{"event":"bad","properties":{"token":"t","time":"now"}}`,
+		``,
+		`{"event":"long","properties":{"token":"t","text":"` + long + `","$insert_id":"not valid!"}}`,
+		`{"event":"deep","properties":{"token":"t","a":{"b":{"c":{"d":{}}}}}}`,
+		`{"$token":"t","$distinct_id":"u1","$set":{"plan":"pro"}}`,
+		`{"$token":"t","$distinct_id":"u1","$unset":[]}`,
+		`[1]`,
+	}, "\n")
+
+	e, stdout := testEnv(nil, input)
+	if code := run(context.Background(), []string{"validate"}, e); code != exitFailure {
+		t.Fatalf("expected exit code: %d, actual: %d, stderr: %s", exitFailure, code, e.stderr)
+	}
+
+	actual := [][2]interface{}{}
+	scanner := bufio.NewScanner(stdout)
+
+	for scanner.Scan() {
+		p := problem{}
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+
+		actual = append(actual, [2]interface{}{p.Line, p.Path})
+	}
+
+	expected := [][2]interface{}{
+		{2, "/properties/time"},
+		{4, "/properties/$insert_id"},
+		{4, "/properties/text"},
+		{5, "/properties/a/b/c/d"},
+		{7, "/$unset"},
+		{8, ""},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected problems: %v, actual: %v", expected, actual)
+	}
+
+	e, _ = testEnv(nil, input)
+	if code := run(context.Background(), []string{"validate", "-type", "engage", "-output", "xml"}, e); code != exitUsage {
+		t.Fatalf("expected exit code: %d, actual: %d", exitUsage, code)
+	}
+}
@@ -0,0 +1,286 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+var (
+	// ErrQueueFull is returned by AsyncClient when its queue has no room for more items.
+	ErrQueueFull = errors.New("queue is full")
+	// ErrClientClosed is returned by AsyncClient after Close.
+	ErrClientClosed = errors.New("client is closed")
+)
+
+// AsyncQueue is the queue name reported by AsyncClient to MetricsObserver.
+const AsyncQueue = "async"
+
+// AsyncSettings describes buffering and delivery of AsyncClient.
+type AsyncSettings struct {
+	// QueueSize is the maximum number of items waiting for delivery. Default is 10000.
+	QueueSize int
+
+	// FlushInterval is the maximum time an item waits for a full batch. Default is 1 second.
+	FlushInterval time.Duration
+
+	// Timeout limits delivery of each batch. Default is 30 seconds.
+	Timeout time.Duration
+
+	// OnError is called from background goroutine with every delivery error. Callback must not block.
+	OnError func(error)
+
+	// Metrics receives depth of the queue, see AsyncQueue.
+	Metrics MetricsObserver
+}
+
+// asyncItem is either event or profile action.
+type asyncItem struct {
+	event  *event.Data
+	action profile.Mutator
+}
+
+// AsyncClient implements Client which queues items and delivers them in batches from background goroutine,
+// so callers are not blocked by requests to Mixpanel. Calls return ErrQueueFull instead of blocking.
+// Events tracked with TrackDeduplicate are batched too, batch endpoint deduplicates events by $insert_id.
+// Close must be called to deliver remaining items.
+type AsyncClient struct {
+	client   Client
+	settings AsyncSettings
+	queue    chan asyncItem
+	flushes  chan chan struct{}
+	done     chan struct{}
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+var _ Client = (*AsyncClient)(nil)
+
+// NewAsyncClient wraps client to deliver items asynchronously and starts background goroutine.
+func NewAsyncClient(client Client, settings AsyncSettings) (*AsyncClient, error) {
+	if client == nil {
+		return nil, fmt.Errorf("client is nil")
+	}
+
+	if settings.QueueSize <= 0 {
+		settings.QueueSize = 10000
+	}
+
+	if settings.FlushInterval <= 0 {
+		settings.FlushInterval = time.Second
+	}
+
+	if settings.Timeout <= 0 {
+		settings.Timeout = 30 * time.Second
+	}
+
+	a := &AsyncClient{
+		client:   client,
+		settings: settings,
+		queue:    make(chan asyncItem, settings.QueueSize),
+		flushes:  make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	go a.run()
+
+	return a, nil
+}
+
+// Track implements Client interface.
+func (a *AsyncClient) Track(ctx context.Context, data *event.Data) error {
+	return a.enqueueEvent(ctx, data)
+}
+
+// TrackDeduplicate implements Client interface.
+func (a *AsyncClient) TrackDeduplicate(ctx context.Context, data *event.Data) error {
+	return a.enqueueEvent(ctx, data)
+}
+
+// TrackBatch implements Client interface, events which did not fit into the queue are dropped.
+func (a *AsyncClient) TrackBatch(ctx context.Context, batch []*event.Data) error {
+	for _, data := range batch {
+		if err := a.enqueueEvent(ctx, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Engage implements Client interface.
+func (a *AsyncClient) Engage(_ context.Context, action profile.Mutator) error {
+	return a.enqueue(asyncItem{action: action})
+}
+
+// EngageBatch implements Client interface, actions which did not fit into the queue are dropped.
+func (a *AsyncClient) EngageBatch(_ context.Context, batch []profile.Mutator) error {
+	for _, action := range batch {
+		if err := a.enqueue(asyncItem{action: action}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// enqueueEvent merges values carried by ctx into event right away, because ctx is not passed to the queue.
+func (a *AsyncClient) enqueueEvent(ctx context.Context, data *event.Data) error {
+	if data == nil {
+		return fmt.Errorf("event object is nil")
+	}
+
+	return a.enqueue(asyncItem{event: withContext(ctx, data)})
+}
+
+func (a *AsyncClient) enqueue(item asyncItem) error {
+	if item.event == nil && item.action == nil {
+		return fmt.Errorf("item is nil")
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return ErrClientClosed
+	}
+
+	select {
+	case a.queue <- item:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Flush delivers all queued items and waits until they are sent.
+func (a *AsyncClient) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+
+	select {
+	case a.flushes <- flushed:
+	case <-a.done:
+		return ErrClientClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-flushed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting items and waits until queued items are delivered or ctx is done.
+func (a *AsyncClient) Close(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run collects batches until the queue is closed.
+func (a *AsyncClient) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.settings.FlushInterval)
+	defer ticker.Stop()
+
+	var (
+		events  []*event.Data
+		actions []profile.Mutator
+	)
+
+	add := func(item asyncItem) {
+		if item.event != nil {
+			events = append(events, item.event)
+		} else {
+			actions = append(actions, item.action)
+		}
+	}
+	flush := func() {
+		a.deliver(events, actions)
+		events, actions = nil, nil
+	}
+
+	for {
+		select {
+		case item, ok := <-a.queue:
+			if !ok {
+				flush()
+
+				return
+			}
+
+			add(item)
+
+			if len(events) >= TrackBatchLimit || len(actions) >= TrackBatchLimit {
+				flush()
+			}
+		case flushed := <-a.flushes:
+			for pending := len(a.queue); pending > 0; pending-- {
+				add(<-a.queue)
+			}
+
+			flush()
+			close(flushed)
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// deliver sends events and profile actions in batches.
+func (a *AsyncClient) deliver(events []*event.Data, actions []profile.Mutator) {
+	for start := 0; start < len(events); start += TrackBatchLimit {
+		end := start + TrackBatchLimit
+		if end > len(events) {
+			end = len(events)
+		}
+
+		a.send(func(ctx context.Context) error {
+			return a.client.TrackBatch(ctx, events[start:end])
+		})
+	}
+
+	for start := 0; start < len(actions); start += TrackBatchLimit {
+		end := start + TrackBatchLimit
+		if end > len(actions) {
+			end = len(actions)
+		}
+
+		a.send(func(ctx context.Context) error {
+			return a.client.EngageBatch(ctx, actions[start:end])
+		})
+	}
+
+	if a.settings.Metrics != nil {
+		a.settings.Metrics.ObserveQueueDepth(AsyncQueue, len(a.queue))
+	}
+}
+
+func (a *AsyncClient) send(call func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), a.settings.Timeout)
+	defer cancel()
+
+	if err := call(ctx); err != nil && a.settings.OnError != nil {
+		a.settings.OnError(err)
+	}
+}
@@ -0,0 +1,126 @@
+package ingestion_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+func Test_AsyncClient_batches(t *testing.T) {
+	recorder := ingestiontest.NewRecorder()
+	recorder.FailEvent("e7", errors.New("rejected"))
+
+	var (
+		mu     sync.Mutex
+		errs   []error
+		depths []int
+	)
+
+	cli, err := ingestion.NewAsyncClient(recorder, ingestion.AsyncSettings{
+		FlushInterval: time.Hour,
+		OnError: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			errs = append(errs, err)
+		},
+		Metrics: ingestion.MetricsObserverFuncs{QueueDepth: func(queue string, depth int) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			depths = append(depths, depth)
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	for i := 0; i < 60; i++ {
+		if err := cli.Track(ctx, &event.Data{Event: fmt.Sprintf("e%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cli.Engage(ctx, &profile.Set{DistinctID: "u1", Set: map[string]interface{}{"plan": "pro"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := recorder.Calls()
+	if len(calls) != 3 ||
+		calls[0].Method != ingestiontest.TrackBatch || len(calls[0].Events) != ingestion.TrackBatchLimit ||
+		calls[1].Method != ingestiontest.TrackBatch || len(calls[1].Events) != 10 ||
+		calls[2].Method != ingestiontest.EngageBatch || len(calls[2].Profiles) != 1 {
+		t.Fatalf("unexpected calls: %+v", calls)
+	}
+
+	mu.Lock()
+	if len(errs) != 1 || len(depths) == 0 {
+		t.Fatalf("unexpected errors: %v, queue depths: %v", errs, depths)
+	}
+	mu.Unlock()
+
+	if err := cli.Track(ctx, &event.Data{Event: "last"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if events := recorder.EventsByName("last"); len(events) != 1 {
+		t.Fatalf("event is not delivered on close: %v", events)
+	}
+
+	if err := cli.Track(ctx, &event.Data{Event: "closed"}); !errors.Is(err, ingestion.ErrClientClosed) {
+		t.Fatalf("unexpected error after close: %v", err)
+	}
+}
+
+func Test_AsyncClient_queue_full(t *testing.T) {
+	blocked := make(chan struct{})
+	recorder := ingestiontest.NewRecorder()
+	recorder.FailWhen(func(*ingestiontest.Call) error {
+		<-blocked
+
+		return nil
+	})
+
+	cli, err := ingestion.NewAsyncClient(recorder, ingestion.AsyncSettings{QueueSize: 1, FlushInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	var full error
+
+	// the first event blocks delivery, the next one fills the queue
+	for i := 0; i < 100 && full == nil; i++ {
+		full = cli.Track(ctx, &event.Data{Event: "e"})
+		time.Sleep(time.Millisecond)
+	}
+
+	if !errors.Is(full, ingestion.ErrQueueFull) {
+		t.Fatalf("unexpected error: %v", full)
+	}
+
+	close(blocked)
+
+	if err := cli.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
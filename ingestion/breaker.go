@@ -0,0 +1,286 @@
+package ingestion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending request to Mixpanel when circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState describes state of the client circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed is normal state, all requests are passed to Mixpanel.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen state rejects all requests with ErrCircuitOpen.
+	BreakerOpen
+	// BreakerHalfOpen state passes limited number of trial requests to check Mixpanel is recovered.
+	BreakerHalfOpen
+)
+
+// String implements fmt.Stringer interface.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerSettings describes circuit breaker behavior.
+// At least one of ConsecutiveFailures or FailureRate rules must be set.
+type BreakerSettings struct {
+	// ConsecutiveFailures is the number of failed requests in a row to open the breaker.
+	// Zero value disables the rule.
+	ConsecutiveFailures int
+
+	// FailureRate is the ratio (0, 1] of failed requests within Window to open the breaker.
+	// Zero value disables the rule.
+	FailureRate float64
+
+	// MinRequests is the minimal number of requests within Window to evaluate FailureRate.
+	// Default is 10.
+	MinRequests int
+
+	// Window is the interval to count requests for FailureRate, counters are reset at the end of each window.
+	// Default is 1 minute.
+	Window time.Duration
+
+	// OpenTimeout is the period the breaker stays open before switching to half-open state.
+	// Default is 30 seconds.
+	OpenTimeout time.Duration
+
+	// HalfOpenRequests is the number of trial requests passed in half-open state.
+	// The breaker is closed when all of them succeed, and opened again on the first failure.
+	// Trials canceled by the caller are not counted. Default is 1.
+	HalfOpenRequests int
+
+	// OnStateChange is called synchronously every time the breaker changes its state.
+	// Callback must not block.
+	OnStateChange func(from, to BreakerState)
+}
+
+// outcome is result of request passed by the breaker.
+type outcome int
+
+const (
+	succeeded outcome = iota
+	failed
+	// abandoned request is canceled by the caller, so it says nothing about Mixpanel.
+	abandoned
+)
+
+type breaker struct {
+	settings BreakerSettings
+
+	mu sync.Mutex
+	// generation is changed with every state, so results of requests passed in previous state are ignored.
+	generation  uint64
+	state       BreakerState
+	openedAt    time.Time
+	windowStart time.Time
+	requests    int
+	failures    int
+	consecutive int
+	trials      int
+	successes   int
+}
+
+func newBreaker(settings BreakerSettings) (*breaker, error) {
+	switch {
+	case settings.ConsecutiveFailures < 0:
+		return nil, fmt.Errorf("negative number of consecutive failures")
+	case settings.FailureRate < 0 || settings.FailureRate > 1:
+		return nil, fmt.Errorf("failure rate %v is out of range (0, 1]", settings.FailureRate)
+	case settings.ConsecutiveFailures == 0 && settings.FailureRate == 0:
+		return nil, fmt.Errorf("neither consecutive failures nor failure rate is set")
+	}
+
+	if settings.Window <= 0 {
+		settings.Window = time.Minute
+	}
+
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = 30 * time.Second
+	}
+
+	if settings.MinRequests <= 0 {
+		settings.MinRequests = 10
+	}
+
+	if settings.HalfOpenRequests <= 0 {
+		settings.HalfOpenRequests = 1
+	}
+
+	return &breaker{settings: settings, windowStart: time.Now()}, nil
+}
+
+// WithCircuitBreaker enables circuit breaker around HTTP requests to Mixpanel.
+// While the breaker is open the client fails fast with ErrCircuitOpen.
+// Transport errors, exceeded deadlines, 429 and 5xx responses are counted as failures,
+// requests canceled by the caller are not counted.
+func WithCircuitBreaker(settings BreakerSettings) ClientOption {
+	return func(c *client) error {
+		b, err := newBreaker(settings)
+		if err != nil {
+			return fmt.Errorf("circuit breaker: %w", err)
+		}
+
+		c.breaker = b
+
+		return nil
+	}
+}
+
+// allow checks request can be passed and registers it, returns generation to report the result with done.
+func (b *breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	notify := b.expire(time.Now())
+	generation := b.generation
+
+	var err error
+
+	switch b.state {
+	case BreakerOpen:
+		err = ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.trials >= b.settings.HalfOpenRequests {
+			err = ErrCircuitOpen
+		} else {
+			b.trials++
+		}
+	case BreakerClosed:
+	}
+	b.mu.Unlock()
+
+	notify()
+
+	return generation, err
+}
+
+// done registers result of request passed by allow with generation.
+func (b *breaker) done(generation uint64, result outcome) {
+	b.mu.Lock()
+	now := time.Now()
+	notify := b.expire(now)
+
+	switch {
+	case generation != b.generation:
+		// result of request passed before the breaker changed its state
+	case b.state == BreakerHalfOpen:
+		notify = b.trialDone(result, now)
+	case b.state == BreakerClosed && result != abandoned:
+		b.requests++
+
+		if result == failed {
+			b.failures++
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+
+		if b.tripped() {
+			notify = b.switchTo(BreakerOpen, now)
+		}
+	}
+	b.mu.Unlock()
+
+	notify()
+}
+
+// trialDone registers result of trial request in half-open state, abandoned trial frees its place.
+// Must be called under lock, returned func must be called after unlock.
+func (b *breaker) trialDone(result outcome, now time.Time) func() {
+	switch {
+	case result == abandoned:
+		b.trials--
+	case result == failed:
+		return b.switchTo(BreakerOpen, now)
+	case b.successes+1 >= b.settings.HalfOpenRequests:
+		return b.switchTo(BreakerClosed, now)
+	default:
+		b.successes++
+	}
+
+	return func() {}
+}
+
+func (b *breaker) tripped() bool {
+	s := b.settings
+	if s.ConsecutiveFailures > 0 && b.consecutive >= s.ConsecutiveFailures {
+		return true
+	}
+
+	return s.FailureRate > 0 &&
+		b.requests >= s.MinRequests &&
+		float64(b.failures)/float64(b.requests) >= s.FailureRate
+}
+
+// expire moves breaker to the next state by timers.
+// Must be called under lock, returned func must be called after unlock.
+func (b *breaker) expire(now time.Time) func() {
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) >= b.settings.OpenTimeout {
+			return b.switchTo(BreakerHalfOpen, now)
+		}
+	case BreakerClosed:
+		if now.Sub(b.windowStart) >= b.settings.Window {
+			b.windowStart = now
+			b.requests, b.failures = 0, 0
+		}
+	case BreakerHalfOpen:
+	}
+
+	return func() {}
+}
+
+// switchTo changes state and resets counters.
+// Must be called under lock, returned func must be called after unlock.
+func (b *breaker) switchTo(state BreakerState, now time.Time) func() {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.windowStart = now
+	b.requests, b.failures, b.consecutive = 0, 0, 0
+	b.trials, b.successes = 0, 0
+
+	if state == BreakerOpen {
+		b.openedAt = now
+	}
+
+	callback := b.settings.OnStateChange
+	if callback == nil || from == state {
+		return func() {}
+	}
+
+	return func() {
+		callback(from, state)
+	}
+}
+
+// deliveryOutcome reports whether the request result indicates Mixpanel or network is unavailable.
+func deliveryOutcome(ctx context.Context, resp *http.Response, err error) outcome {
+	switch {
+	case err != nil && (errors.Is(ctx.Err(), context.Canceled) || errors.Is(err, context.Canceled)):
+		return abandoned
+	case err != nil,
+		resp == nil,
+		resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode >= http.StatusInternalServerError:
+		return failed
+	}
+
+	return succeeded
+}
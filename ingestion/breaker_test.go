@@ -0,0 +1,277 @@
+package ingestion_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+func ResponseStatus(code int, req *http.Request) *http.Response {
+	return &http.Response{
+		Request:    req,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Status:     http.StatusText(code),
+		StatusCode: code,
+		Body:       ioutil.NopCloser(strings.NewReader(`{"status":1}`)),
+	}
+}
+
+func Test_Client_circuit_breaker(t *testing.T) {
+	var (
+		failing     = true
+		calls       = 0
+		transitions = []string{}
+	)
+
+	doer := HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if failing {
+			return ResponseStatus(http.StatusServiceUnavailable, req), nil
+		}
+
+		return ResponseStatus(http.StatusOK, req), nil
+	})
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(doer),
+		ingestion.WithCircuitBreaker(ingestion.BreakerSettings{
+			ConsecutiveFailures: 2,
+			OpenTimeout:         20 * time.Millisecond,
+			OnStateChange: func(from, to ingestion.BreakerState) {
+				transitions = append(transitions, from.String()+">"+to.String())
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track := func() error {
+		return cli.Track(context.Background(), &event.Data{Event: "test"})
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := track(); err == nil || errors.Is(err, ingestion.ErrCircuitOpen) {
+			t.Fatalf("[#%d] unexpected error: %v", i, err)
+		}
+	}
+
+	if err := track(); !errors.Is(err, ingestion.ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, actual: %v", err)
+	}
+
+	if calls != 2 {
+		t.Fatalf("open breaker passed request, calls: %d", calls)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	failing = false
+	if err := track(); err != nil {
+		t.Fatalf("trial request failed: %s", err)
+	}
+
+	expected := "closed>open,open>half-open,half-open>closed"
+	if actual := strings.Join(transitions, ","); actual != expected {
+		t.Fatalf("expected transitions %q, actual %q", expected, actual)
+	}
+}
+
+func Test_Client_circuit_breaker_failure_rate(t *testing.T) {
+	calls := 0
+	doer := HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls%2 == 0 {
+			return nil, errors.New("connection reset")
+		}
+
+		return ResponseStatus(http.StatusOK, req), nil
+	})
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(doer),
+		ingestion.WithCircuitBreaker(ingestion.BreakerSettings{
+			FailureRate: 0.5,
+			MinRequests: 4,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := cli.Track(context.Background(), &event.Data{Event: "test"}); errors.Is(err, ingestion.ErrCircuitOpen) {
+			t.Fatalf("[#%d] breaker is open before min requests", i)
+		}
+	}
+
+	if err := cli.Track(context.Background(), &event.Data{Event: "test"}); !errors.Is(err, ingestion.ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, actual: %v", err)
+	}
+}
+
+func Test_WithCircuitBreaker_settings(t *testing.T) {
+	cases := []struct {
+		settings ingestion.BreakerSettings
+		ok       bool
+	}{
+		{ingestion.BreakerSettings{}, false},
+		{ingestion.BreakerSettings{ConsecutiveFailures: -1}, false},
+		{ingestion.BreakerSettings{FailureRate: 1.5}, false},
+		{ingestion.BreakerSettings{ConsecutiveFailures: 5}, true},
+		{ingestion.BreakerSettings{FailureRate: 0.5, MinRequests: 10}, true},
+	}
+
+	for i, c := range cases {
+		_, err := ingestion.NewClient("https://api.mixpanel.com", ingestion.WithCircuitBreaker(c.settings))
+
+		switch {
+		case err != nil && c.ok:
+			t.Fatalf("[#%d] unexpected error: %s", i, err)
+		case err == nil && !c.ok:
+			t.Fatalf("[#%d] expected error, settings: %+v", i, c.settings)
+		}
+	}
+}
+
+func Test_Client_circuit_breaker_stale_result(t *testing.T) {
+	release := map[string]chan struct{}{"slow": make(chan struct{}), "trial": make(chan struct{})}
+	transitions := make(chan string, 10)
+
+	doer := HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+		body, _ := ioutil.ReadAll(req.Body)
+		for name, ch := range release {
+			if strings.Contains(string(body), name) {
+				<-ch
+
+				return ResponseStatus(http.StatusOK, req), nil
+			}
+		}
+
+		return ResponseStatus(http.StatusServiceUnavailable, req), nil
+	})
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(doer),
+		ingestion.WithCircuitBreaker(ingestion.BreakerSettings{
+			ConsecutiveFailures: 1,
+			OpenTimeout:         20 * time.Millisecond,
+			OnStateChange: func(from, to ingestion.BreakerState) {
+				transitions <- from.String() + ">" + to.String()
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track := func(name string, done chan<- error) {
+		done <- cli.Track(context.Background(), &event.Data{Event: name})
+	}
+
+	slow, trial, fail := make(chan error, 1), make(chan error, 1), make(chan error, 1)
+
+	go track("slow", slow)
+	time.Sleep(10 * time.Millisecond)
+	track("fail", fail)
+	<-fail
+	time.Sleep(30 * time.Millisecond)
+
+	go track("trial", trial)
+	time.Sleep(10 * time.Millisecond)
+	close(release["slow"])
+
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Track(context.Background(), &event.Data{Event: "next"}); !errors.Is(err, ingestion.ErrCircuitOpen) {
+		t.Fatalf("request passed before the end of trial: %v", err)
+	}
+
+	close(release["trial"])
+
+	if err := <-trial; err != nil {
+		t.Fatal(err)
+	}
+
+	close(transitions)
+
+	actual := []string{}
+	for transition := range transitions {
+		actual = append(actual, transition)
+	}
+
+	expected := "closed>open,open>half-open,half-open>closed"
+	if strings.Join(actual, ",") != expected {
+		t.Fatalf("expected transitions %q, actual %q", expected, actual)
+	}
+}
+
+func Test_Client_circuit_breaker_canceled_trial(t *testing.T) {
+	failing := true
+	transitions := []string{}
+
+	doer := HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+		if err := req.Context().Err(); err != nil {
+			return nil, err
+		}
+
+		if failing {
+			return ResponseStatus(http.StatusServiceUnavailable, req), nil
+		}
+
+		return ResponseStatus(http.StatusOK, req), nil
+	})
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(doer),
+		ingestion.WithCircuitBreaker(ingestion.BreakerSettings{
+			ConsecutiveFailures: 1,
+			OpenTimeout:         20 * time.Millisecond,
+			OnStateChange: func(from, to ingestion.BreakerState) {
+				transitions = append(transitions, from.String()+">"+to.String())
+			},
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Track(context.Background(), &event.Data{Event: "test"}); err == nil {
+		t.Fatal("expected failure")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := cli.Track(canceled, &event.Data{Event: "test"}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error of canceled trial: %v", err)
+	}
+
+	if expected := "closed>open,open>half-open"; strings.Join(transitions, ",") != expected {
+		t.Fatalf("canceled trial changed state: %q", transitions)
+	}
+
+	failing = false
+	if err := cli.Track(context.Background(), &event.Data{Event: "test"}); err != nil {
+		t.Fatalf("trial is not passed after canceled one: %s", err)
+	}
+
+	if expected := "closed>open,open>half-open,half-open>closed"; strings.Join(transitions, ",") != expected {
+		t.Fatalf("unexpected transitions %q", transitions)
+	}
+}
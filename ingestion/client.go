@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/wtask-go/mixpanel/ingestion/event"
 	"github.com/wtask-go/mixpanel/ingestion/profile"
@@ -45,11 +46,28 @@ type client struct {
 			append  *url.URL
 			remove  *url.URL
 			unset   *url.URL
+			delete  *url.URL
 			batch   *url.URL
 		}
 	}
-	httpc HTTPDoer
-	agent string
+	interceptors struct {
+		event   []EventInterceptor
+		profile []ProfileInterceptor
+		request []RequestInterceptor
+	}
+	httpc         HTTPDoer
+	agent         string
+	breaker       *breaker
+	metrics       MetricsObserver
+	logger        Logger
+	dumpLimit     int
+	deadLetters   DeadLetterSink
+	super         *SuperProperties
+	timers        *EventTimers
+	token         string
+	tokenMismatch TokenMismatch
+	consent       ConsentStore
+	optOutPolicy  OptOutPolicy
 }
 
 // ClientOption provides customization for Ingestion API client.
@@ -67,8 +85,9 @@ func NewClient(serverURL string, options ...ClientOption) (Client, error) {
 		return nil, fmt.Errorf("parse server URL: %w", err)
 	}
 
+	// path prefix of server URL is kept, e.g. for proxies like `https://proxy.example.com/mp`
 	serverRef := func(path, fragment string) *url.URL {
-		return server.ResolveReference(&url.URL{Path: path, Fragment: fragment})
+		return server.ResolveReference(&url.URL{Path: server.Path + path, Fragment: fragment})
 	}
 
 	cli := &client{}
@@ -82,6 +101,7 @@ func NewClient(serverURL string, options ...ClientOption) (Client, error) {
 	cli.endpoint.engage.append = serverRef("/engage", "profile-list-append")
 	cli.endpoint.engage.remove = serverRef("/engage", "profile-list-remove")
 	cli.endpoint.engage.unset = serverRef("/engage", "profile-unset")
+	cli.endpoint.engage.delete = serverRef("/engage", "profile-delete")
 	cli.endpoint.engage.batch = serverRef("/engage", "profile-batch-update")
 
 	cli.httpc = &http.Client{
@@ -126,7 +146,8 @@ func WithUserAgent(agent string) ClientOption {
 	}
 }
 
-func (c *client) send(ctx context.Context, req *http.Request) error {
+// send executes request which contains specified number of items.
+func (c *client) send(ctx context.Context, req *http.Request, items int) error {
 	req = req.WithContext(ctx)
 	req.Header.Set("Accept", "plain/text")
 	req.Header.Add("Accept", "application/json")
@@ -135,7 +156,31 @@ func (c *client) send(ctx context.Context, req *http.Request) error {
 		req.Header.Set("User-Agent", c.agent)
 	}
 
-	resp, err := c.httpc.Do(req)
+	started := time.Now()
+	err := c.roundTrip(ctx, req)
+	c.observeRequest(req.URL, items, deliveryAttempt(ctx), req.ContentLength, time.Since(started), err)
+	c.logFailure(req, items, err)
+
+	return err
+}
+
+func (c *client) roundTrip(ctx context.Context, req *http.Request) error {
+	var generation uint64
+
+	if c.breaker != nil {
+		g, err := c.breaker.allow()
+		if err != nil {
+			return err
+		}
+
+		generation = g
+	}
+
+	resp, err := c.do(req)
+	if c.breaker != nil {
+		c.breaker.done(generation, deliveryOutcome(ctx, resp, err))
+	}
+
 	if err != nil {
 		return err
 	}
@@ -144,46 +189,115 @@ func (c *client) send(ctx context.Context, req *http.Request) error {
 }
 
 func (c *client) Track(ctx context.Context, data *event.Data) error {
+	data, err := c.interceptEvent(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		c.observeDropped(c.endpoint.track.live, 1)
+
+		return nil
+	}
+
 	req, err := c.makeTrackRequest(data)
 	if err != nil {
 		return err
 	}
 
-	return c.send(ctx, req)
+	err = c.send(ctx, req, 1)
+
+	return c.putDeadLetter(ctx, req.URL, []*event.Data{data}, nil, err)
 }
 
 func (c *client) TrackDeduplicate(ctx context.Context, data *event.Data) error {
+	data, err := c.interceptEvent(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		c.observeDropped(c.endpoint.track.deduplicate, 1)
+
+		return nil
+	}
+
 	req, err := c.makeTrackDeduplicateRequest(data)
 	if err != nil {
 		return err
 	}
 
-	return c.send(ctx, req)
+	err = c.send(ctx, req, 1)
+
+	return c.putDeadLetter(ctx, req.URL, []*event.Data{data}, nil, err)
 }
 
-func (c *client) TrackBatch(ctx context.Context, data []*event.Data) error {
+func (c *client) TrackBatch(ctx context.Context, batch []*event.Data) error {
+	data, err := c.interceptEvents(ctx, batch)
+	if err != nil {
+		return err
+	}
+
+	c.observeDropped(c.endpoint.track.batch, len(batch)-len(data))
+
+	if len(batch) > 0 && len(data) == 0 {
+		return nil
+	}
+
 	req, err := c.makeTrackBatchRequest(data)
 	if err != nil {
 		return err
 	}
 
-	return c.send(ctx, req)
+	err = c.send(ctx, req, len(data))
+
+	return c.putDeadLetter(ctx, req.URL, data, nil, err)
 }
 
 func (c *client) Engage(ctx context.Context, action profile.Mutator) error {
+	endpoint, err := c.engageEndpoint(action)
+	if err != nil {
+		return err
+	}
+
+	if action, err = c.interceptProfile(ctx, action); err != nil {
+		return err
+	}
+
+	if action == nil {
+		c.observeDropped(endpoint, 1)
+
+		return nil
+	}
+
 	req, err := c.makeEngageRequest(action)
 	if err != nil {
 		return err
 	}
 
-	return c.send(ctx, req)
+	err = c.send(ctx, req, 1)
+
+	return c.putDeadLetter(ctx, req.URL, nil, []profile.Mutator{action}, err)
 }
 
 func (c *client) EngageBatch(ctx context.Context, batch []profile.Mutator) error {
-	req, err := c.makeEngageBatchRequest(batch)
+	actions, err := c.interceptProfiles(ctx, batch)
 	if err != nil {
+		return err
+	}
+
+	c.observeDropped(c.endpoint.engage.batch, len(batch)-len(actions))
+
+	if len(batch) > 0 && len(actions) == 0 {
 		return nil
 	}
 
-	return c.send(ctx, req)
+	req, err := c.makeEngageBatchRequest(actions)
+	if err != nil {
+		return err
+	}
+
+	err = c.send(ctx, req, len(actions))
+
+	return c.putDeadLetter(ctx, req.URL, nil, actions, err)
 }
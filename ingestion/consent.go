@@ -0,0 +1,161 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+// ConsentStore keeps tracking consent of users, like `opt_out_tracking` of Mixpanel SDKs.
+type ConsentStore interface {
+	OptOut(ctx context.Context, distinctID string) error
+	OptIn(ctx context.Context, distinctID string) error
+	OptedOut(ctx context.Context, distinctID string) (bool, error)
+}
+
+// MemoryConsentStore is ConsentStore which keeps opted-out users in memory, it is safe for concurrent use.
+type MemoryConsentStore struct {
+	mu       sync.RWMutex
+	optedOut map[string]bool
+}
+
+// NewMemoryConsentStore builds empty in-memory consent store, all users are opted in.
+func NewMemoryConsentStore() *MemoryConsentStore {
+	return &MemoryConsentStore{optedOut: map[string]bool{}}
+}
+
+// OptOut implements ConsentStore interface.
+func (s *MemoryConsentStore) OptOut(_ context.Context, distinctID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.optedOut[distinctID] = true
+
+	return nil
+}
+
+// OptIn implements ConsentStore interface.
+func (s *MemoryConsentStore) OptIn(_ context.Context, distinctID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.optedOut, distinctID)
+
+	return nil
+}
+
+// OptedOut implements ConsentStore interface.
+func (s *MemoryConsentStore) OptedOut(_ context.Context, distinctID string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.optedOut[distinctID], nil
+}
+
+// OptOutPolicy describes how the client handles events of opted-out users.
+type OptOutPolicy int
+
+const (
+	// DropOptedOut drops events of opted-out users.
+	DropOptedOut OptOutPolicy = iota
+	// AnonymizeOptedOut removes distinct ID and IP address from events of opted-out users.
+	// Custom properties are sent as is, so they must not identify the user.
+	AnonymizeOptedOut
+)
+
+// WithConsentStore makes the client to check consent of users before every Track and Engage call.
+// Events of opted-out users are handled according to policy, their profile actions are dropped,
+// except profile.Delete. Events without distinct ID are not checked.
+// Store failures abort the call, so nothing is sent without known consent.
+// Dead letters keep items after consent is applied, dropped items and identity of opted-out users are not kept.
+func WithConsentStore(store ConsentStore, policy OptOutPolicy) ClientOption {
+	return func(c *client) error {
+		switch {
+		case store == nil:
+			return fmt.Errorf("consent store is nil")
+		case policy != DropOptedOut && policy != AnonymizeOptedOut:
+			return fmt.Errorf("unknown opt-out policy %d", policy)
+		}
+
+		c.consent, c.optOutPolicy = store, policy
+
+		return nil
+	}
+}
+
+// OptOutTracking opts user out of tracking and optionally deletes the profile of user.
+// The client must not drop profile.Delete, which is true for the client with consent store.
+func OptOutTracking(
+	ctx context.Context,
+	client Client,
+	store ConsentStore,
+	token string,
+	distinctID string,
+	deleteProfile bool,
+) error {
+	if err := store.OptOut(ctx, distinctID); err != nil {
+		return fmt.Errorf("opt out: %w", err)
+	}
+
+	if !deleteProfile {
+		return nil
+	}
+
+	if err := client.Engage(ctx, &profile.Delete{Token: token, DistinctID: distinctID}); err != nil {
+		return fmt.Errorf("delete profile: %w", err)
+	}
+
+	return nil
+}
+
+// consentEvent returns event allowed by consent of the user or nil if the event must be dropped.
+func (c *client) consentEvent(ctx context.Context, data *event.Data) (*event.Data, error) {
+	if data.Properties.DistinctID == "" {
+		return data, nil
+	}
+
+	optedOut, err := c.consent.OptedOut(ctx, data.Properties.DistinctID)
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("consent: %w", err)
+	case !optedOut:
+		return data, nil
+	case c.optOutPolicy == DropOptedOut:
+		return nil, nil
+	}
+
+	anonymized := *data
+	anonymized.Properties.DistinctID = ""
+	anonymized.Properties.IP = ""
+
+	return &anonymized, nil
+}
+
+// consentResubmitted checks consent of the user again for resubmitted event, who may have opted out since.
+func (c *client) consentResubmitted(ctx context.Context, data *event.Data) (*event.Data, error) {
+	if c.consent == nil {
+		return data, nil
+	}
+
+	return c.consentEvent(ctx, data)
+}
+
+// consentProfile returns profile action allowed by consent of the user or nil if the action must be dropped.
+func (c *client) consentProfile(ctx context.Context, action profile.Mutator) (profile.Mutator, error) {
+	if _, ok := action.(*profile.Delete); ok {
+		return action, nil
+	}
+
+	optedOut, err := c.consent.OptedOut(ctx, profile.DistinctID(action))
+	switch {
+	case err != nil:
+		return nil, fmt.Errorf("consent: %w", err)
+	case optedOut:
+		return nil, nil
+	}
+
+	return action, nil
+}
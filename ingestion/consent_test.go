@@ -0,0 +1,240 @@
+package ingestion_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+func Test_Client_consent(t *testing.T) {
+	emulator := ingestiontest.NewEmulator()
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	store := ingestion.NewMemoryConsentStore()
+	ctx := context.Background()
+
+	cli, err := ingestion.NewClient(server.URL, ingestion.WithConsentStore(store, ingestion.DropOptedOut))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"u1", "u2"} {
+		if err := cli.Engage(ctx, &profile.Set{DistinctID: id, Set: map[string]interface{}{"plan": "free"}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := ingestion.OptOutTracking(ctx, cli, store, "", "u1", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ingestion.OptOutTracking(ctx, cli, store, "", "u2", false); err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.TrackBatch(ctx, []*event.Data{
+		{Event: "e1", Properties: event.Properties{DistinctID: "u1"}},
+		{Event: "e2", Properties: event.Properties{DistinctID: "u3"}},
+		{Event: "e3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Engage(ctx, &profile.Set{DistinctID: "u2", Set: map[string]interface{}{"plan": "premium"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if events := emulator.Events(); len(events) != 2 || events[0].Event != "e2" || events[1].Event != "e3" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	if _, ok := emulator.Profile("u1"); ok {
+		t.Fatal("profile of opted-out user is not deleted")
+	}
+
+	if properties, _ := emulator.Profile("u2"); properties["plan"] != "free" {
+		t.Fatalf("profile of opted-out user is changed: %+v", properties)
+	}
+
+	if err := store.OptIn(ctx, "u2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Track(ctx, &event.Data{Event: "e4", Properties: event.Properties{DistinctID: "u2"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if events := emulator.Events(); len(events) != 3 {
+		t.Fatalf("event of opted-in user is dropped: %+v", events)
+	}
+}
+
+type failingConsentStore struct {
+	*ingestion.MemoryConsentStore
+}
+
+func (failingConsentStore) OptedOut(context.Context, string) (bool, error) {
+	return false, errors.New("unavailable")
+}
+
+func Test_Client_consent_anonymize(t *testing.T) {
+	store := ingestion.NewMemoryConsentStore()
+	seen := []*event.Data{}
+
+	options := func(store ingestion.ConsentStore) []ingestion.ClientOption {
+		return []ingestion.ClientOption{
+			ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+				return ResponseStatus(http.StatusOK, req), nil
+			})),
+			ingestion.WithConsentStore(store, ingestion.AnonymizeOptedOut),
+			ingestion.WithEventInterceptor(func(_ context.Context, data *event.Data) (*event.Data, error) {
+				seen = append(seen, data)
+
+				return data, nil
+			}),
+		}
+	}
+
+	cli, err := ingestion.NewClient("https://api.mixpanel.com", options(store)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.OptOut(context.Background(), "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := ingestion.ContextWithDistinctID(context.Background(), "u1")
+	tracked := &event.Data{Event: "e", Properties: event.Properties{IP: "10.0.0.1"}}
+
+	if err := cli.Track(ctx, tracked); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != 1 || seen[0].Properties.DistinctID != "" || seen[0].Properties.IP != "" ||
+		tracked.Properties.IP == "" {
+		t.Fatalf("unexpected events: %+v", seen)
+	}
+
+	failing, err := ingestion.NewClient("https://api.mixpanel.com", options(failingConsentStore{store})...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := failing.Track(ctx, &event.Data{Event: "e"}); err == nil {
+		t.Fatal("event is tracked without known consent")
+	}
+
+	if err := failing.Engage(ctx, &profile.Set{DistinctID: "u2"}); err == nil {
+		t.Fatal("profile is changed without known consent")
+	}
+}
+
+func Test_Client_consent_dead_letters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.ndjson")
+
+	sink, err := ingestion.NewFileDeadLetterSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := ingestion.NewMemoryConsentStore()
+	posted := []string{}
+	available := false
+
+	options := func(policy ingestion.OptOutPolicy, sink ingestion.DeadLetterSink) []ingestion.ClientOption {
+		return []ingestion.ClientOption{
+			ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+				if err := req.ParseForm(); err != nil {
+					return nil, err
+				}
+
+				posted = append(posted, req.PostForm.Get("data"))
+				if !available {
+					return nil, errors.New("connection refused")
+				}
+
+				return ResponseStatus(http.StatusOK, req), nil
+			})),
+			ingestion.WithConsentStore(store, policy),
+			ingestion.WithDeadLetterSink(sink),
+		}
+	}
+
+	if err := store.OptOut(context.Background(), "u1"); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := func() []*event.Data {
+		return []*event.Data{
+			{Event: "e", Properties: event.Properties{DistinctID: "u1", IP: "10.0.0.1"}},
+			{Event: "e", Properties: event.Properties{DistinctID: "u2", IP: "10.0.0.2"}},
+		}
+	}
+
+	anonymizing, err := ingestion.NewClient("https://api.mixpanel.com", options(ingestion.AnonymizeOptedOut, sink)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := anonymizing.TrackBatch(context.Background(), batch()); err == nil {
+		t.Fatal("expected delivery error")
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bytes.Contains(content, []byte(`"u1"`)) || bytes.Contains(content, []byte("10.0.0.1")) ||
+		!bytes.Contains(content, []byte(`"u2"`)) {
+		t.Fatalf("unexpected dead letters: %s", content)
+	}
+
+	dropped := &DeadLetterSinkMock{}
+
+	dropping, err := ingestion.NewClient("https://api.mixpanel.com", options(ingestion.DropOptedOut, dropped)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dropping.TrackBatch(context.Background(), batch()); err == nil {
+		t.Fatal("expected delivery error")
+	}
+
+	if len(dropped.letters) != 1 || len(dropped.letters[0].Events) != 1 ||
+		dropped.letters[0].Events[0].Properties.DistinctID != "u2" {
+		t.Fatalf("unexpected dead letters: %+v", dropped.letters)
+	}
+
+	// user opted out after failure is not sent on resubmission
+	if err := store.OptOut(context.Background(), "u2"); err != nil {
+		t.Fatal(err)
+	}
+
+	available = true
+
+	if err := ingestion.Resubmit(context.Background(), dropping, dropped.letters[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posted) != 2 {
+		t.Fatalf("unexpected requests: %v", posted)
+	}
+}
@@ -0,0 +1,104 @@
+package ingestion
+
+import (
+	"context"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+type contextKey int
+
+const (
+	distinctIDKey contextKey = iota
+	propertiesKey
+)
+
+// reservedProperties are kept in fields of event.Properties, so they are never merged as custom properties.
+var reservedProperties = map[string]bool{
+	"$insert_id":  true,
+	"distinct_id": true,
+	"ip":          true,
+	"time":        true,
+	"token":       true,
+}
+
+// ContextWithDistinctID returns copy of ctx which carries distinct ID for events tracked with it.
+func ContextWithDistinctID(ctx context.Context, distinctID string) context.Context {
+	return context.WithValue(ctx, distinctIDKey, distinctID)
+}
+
+// DistinctIDFromContext returns distinct ID carried by ctx or empty string.
+func DistinctIDFromContext(ctx context.Context) string {
+	distinctID, _ := ctx.Value(distinctIDKey).(string)
+
+	return distinctID
+}
+
+// ContextWithProperties returns copy of ctx which carries custom properties for events tracked with it,
+// e.g. tenant or request ID. Properties are added to ones carried by ctx already, new values win.
+// Reserved properties like `distinct_id` or `token` are ignored, use ContextWithDistinctID instead.
+func ContextWithProperties(ctx context.Context, properties event.CustomProperties) context.Context {
+	parent := PropertiesFromContext(ctx)
+	merged := make(event.CustomProperties, len(parent)+len(properties))
+
+	for name, value := range parent {
+		merged[name] = value
+	}
+
+	for name, value := range properties {
+		if !reservedProperties[name] {
+			merged[name] = value
+		}
+	}
+
+	return context.WithValue(ctx, propertiesKey, merged)
+}
+
+// PropertiesFromContext returns custom properties carried by ctx, returned map must not be modified.
+func PropertiesFromContext(ctx context.Context) event.CustomProperties {
+	properties, _ := ctx.Value(propertiesKey).(event.CustomProperties)
+
+	return properties
+}
+
+// withContext returns event with distinct ID and properties carried by ctx.
+// Values of the event take precedence, the event itself is not modified.
+// It is applied before event interceptors, so they see merged event.
+func withContext(ctx context.Context, data *event.Data) *event.Data {
+	return mergeEvent(data, DistinctIDFromContext(ctx), PropertiesFromContext(ctx))
+}
+
+// mergeEvent returns copy of event with default distinct ID and custom properties,
+// later layers of properties override earlier ones, values of the event override all of them.
+// Event is returned as is if there is nothing to merge.
+func mergeEvent(data *event.Data, distinctID string, layers ...event.CustomProperties) *event.Data {
+	size := 0
+	for _, properties := range layers {
+		size += len(properties)
+	}
+
+	if (distinctID == "" || data.Properties.DistinctID != "") && size == 0 {
+		return data
+	}
+
+	custom := make(event.CustomProperties, len(data.Properties.CustomProperties)+size)
+
+	for _, properties := range layers {
+		for name, value := range properties {
+			custom[name] = value
+		}
+	}
+
+	for name, value := range data.Properties.CustomProperties {
+		custom[name] = value
+	}
+
+	merged := *data
+	merged.Properties.CustomProperties = custom
+
+	if merged.Properties.DistinctID == "" {
+		merged.Properties.DistinctID = distinctID
+	}
+
+	return &merged
+}
@@ -0,0 +1,97 @@
+package ingestion_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+)
+
+func Test_Client_context_properties(t *testing.T) {
+	seen := []*event.Data{}
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+			return ResponseStatus(http.StatusOK, req), nil
+		})),
+		ingestion.WithEventInterceptor(func(_ context.Context, data *event.Data) (*event.Data, error) {
+			seen = append(seen, data)
+
+			return data, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := ingestion.ContextWithDistinctID(context.Background(), "u1")
+	ctx = ingestion.ContextWithProperties(ctx, event.CustomProperties{"tenant": "acme", "request_id": "r1"})
+	ctx = ingestion.ContextWithProperties(ctx, event.CustomProperties{"request_id": "r2", "token": "ignored"})
+
+	explicit := &event.Data{
+		Event:      "explicit",
+		Properties: event.Properties{DistinctID: "u2", CustomProperties: event.CustomProperties{"tenant": "other"}},
+	}
+
+	if err := cli.Track(ctx, explicit); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.TrackBatch(ctx, []*event.Data{{Event: "a"}, {Event: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(explicit.Properties.CustomProperties) != 1 {
+		t.Fatalf("event of caller is modified: %+v", explicit)
+	}
+
+	expected := []struct {
+		distinctID string
+		properties event.CustomProperties
+	}{
+		{"u2", event.CustomProperties{"tenant": "other", "request_id": "r2"}},
+		{"u1", event.CustomProperties{"tenant": "acme", "request_id": "r2"}},
+		{"u1", event.CustomProperties{"tenant": "acme", "request_id": "r2"}},
+	}
+
+	if len(seen) != len(expected) {
+		t.Fatalf("unexpected events: %+v", seen)
+	}
+
+	for i, e := range expected {
+		if seen[i].Properties.DistinctID != e.distinctID ||
+			!reflect.DeepEqual(seen[i].Properties.CustomProperties, e.properties) {
+			t.Fatalf("[#%d] unexpected event: %+v", i, seen[i])
+		}
+	}
+}
+
+func Test_AsyncClient_context_properties(t *testing.T) {
+	recorder := ingestiontest.NewRecorder()
+
+	cli, err := ingestion.NewAsyncClient(recorder, ingestion.AsyncSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := ingestion.ContextWithProperties(ingestion.ContextWithDistinctID(context.Background(), "u1"),
+		event.CustomProperties{"tenant": "acme"})
+
+	if err := cli.Track(ctx, &event.Data{Event: "e"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	events := recorder.EventsByDistinctID("u1")
+	if len(events) != 1 || events[0].Properties.CustomProperties["tenant"] != "acme" {
+		t.Fatalf("unexpected events: %+v", recorder.Events())
+	}
+}
@@ -0,0 +1,286 @@
+package ingestion
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+// DeadLetter describes items which the client failed to deliver.
+// Either Events or Profiles is not empty.
+type DeadLetter struct {
+	// Time when delivery failed.
+	Time time.Time
+	// Endpoint is path and fragment of operation, for example "track#live-event".
+	Endpoint string
+	// Events contains items of Track, TrackDeduplicate or TrackBatch as they were posted.
+	Events []*event.Data
+	// Profiles contains items of Engage or EngageBatch as they were posted.
+	Profiles []profile.Mutator
+	// Err is the final delivery error.
+	Err error
+	// Attempts is the number of delivery attempts including resubmissions.
+	Attempts int
+}
+
+// DeadLetterSink receives items which the client failed to deliver.
+// Implementation must be safe for concurrent use.
+type DeadLetterSink interface {
+	Put(context.Context, *DeadLetter) error
+}
+
+// WithDeadLetterSink sets sink to save items which the client failed to deliver.
+// Items are passed to the sink as they were posted, with super properties, values of context,
+// `$duration` and project token applied by the client and changes made by interceptors.
+// Items dropped or rejected before sending, for example by interceptors, are not dead-lettered.
+func WithDeadLetterSink(sink DeadLetterSink) ClientOption {
+	return func(c *client) error {
+		if sink == nil {
+			return fmt.Errorf("dead letter sink is nil")
+		}
+
+		c.deadLetters = sink
+
+		return nil
+	}
+}
+
+type attemptsKey struct{}
+
+// deliveryAttempt returns number of delivery attempt, it is greater than 1 for items of Resubmit.
+func deliveryAttempt(ctx context.Context) int {
+	attempts, _ := ctx.Value(attemptsKey{}).(int)
+
+	return attempts + 1
+}
+
+// resubmitted reports whether ctx belongs to Resubmit call.
+func resubmitted(ctx context.Context) bool {
+	_, ok := ctx.Value(attemptsKey{}).(int)
+
+	return ok
+}
+
+// putDeadLetter passes undelivered items to the sink and returns delivery error.
+func (c *client) putDeadLetter(
+	ctx context.Context,
+	endpoint *url.URL,
+	events []*event.Data,
+	profiles []profile.Mutator,
+	err error,
+) error {
+	if c.deadLetters == nil || err == nil {
+		return err
+	}
+
+	letter := &DeadLetter{
+		Time:     time.Now().UTC(),
+		Endpoint: endpointName(endpoint),
+		Events:   events,
+		Profiles: profiles,
+		Err:      err,
+		Attempts: deliveryAttempt(ctx),
+	}
+
+	if sinkErr := c.deadLetters.Put(ctx, letter); sinkErr != nil {
+		return fmt.Errorf("%w (dead letter: %s)", err, sinkErr)
+	}
+
+	return err
+}
+
+type deadLetterJSON struct {
+	Time     time.Time         `json:"time"`
+	Endpoint string            `json:"endpoint"`
+	Events   []*event.Data     `json:"events,omitempty"`
+	Profiles []json.RawMessage `json:"profiles,omitempty"`
+	Error    string            `json:"error"`
+	Attempts int               `json:"attempts"`
+}
+
+// MarshalJSON implements json.Marshaler interface.
+func (l *DeadLetter) MarshalJSON() ([]byte, error) {
+	obj := deadLetterJSON{
+		Time:     l.Time,
+		Endpoint: l.Endpoint,
+		Events:   l.Events,
+		Attempts: l.Attempts,
+	}
+
+	if l.Err != nil {
+		obj.Error = l.Err.Error()
+	}
+
+	for _, action := range l.Profiles {
+		raw, err := json.Marshal(action)
+		if err != nil {
+			return nil, fmt.Errorf("marshal profile action: %w", err)
+		}
+
+		obj.Profiles = append(obj.Profiles, raw)
+	}
+
+	return json.Marshal(obj)
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface.
+func (l *DeadLetter) UnmarshalJSON(raw []byte) error {
+	if l == nil {
+		return fmt.Errorf("unmarshal ingestion.DeadLetter to nil")
+	}
+
+	obj := deadLetterJSON{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return err
+	}
+
+	*l = DeadLetter{
+		Time:     obj.Time,
+		Endpoint: obj.Endpoint,
+		Events:   obj.Events,
+		Attempts: obj.Attempts,
+	}
+
+	if obj.Error != "" {
+		l.Err = errors.New(obj.Error)
+	}
+
+	for _, data := range obj.Profiles {
+		action, err := profile.UnmarshalMutator(data)
+		if err != nil {
+			return fmt.Errorf("unmarshal profile action: %w", err)
+		}
+
+		l.Profiles = append(l.Profiles, action)
+	}
+
+	return nil
+}
+
+// FileDeadLetterSink writes dead letters into NDJSON file, one letter per line.
+type FileDeadLetterSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileDeadLetterSink opens file for appending dead letters, the file is created if it does not exist.
+func NewFileDeadLetterSink(path string) (*FileDeadLetterSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open dead letter file: %w", err)
+	}
+
+	return &FileDeadLetterSink{file: f}, nil
+}
+
+// Put implements DeadLetterSink interface.
+func (s *FileDeadLetterSink) Put(_ context.Context, letter *DeadLetter) error {
+	line, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.file.Write(append(line, '\n'))
+
+	return err
+}
+
+// Close closes underlying file.
+func (s *FileDeadLetterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
+
+// ReadDeadLetters reads NDJSON stream written by FileDeadLetterSink and calls fn for every letter.
+// Reading stops on the first error returned by fn.
+func ReadDeadLetters(r io.Reader, fn func(*DeadLetter) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		letter := &DeadLetter{}
+		if err := json.Unmarshal(scanner.Bytes(), letter); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err := fn(letter); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Resubmit sends dead-lettered items again through the client with the same method which was failed.
+// Items are sent as is, the client built by NewClient does not apply event preparation
+// and interceptors to them again, so timers are not finished and sampling is not repeated.
+// Consent of users is checked again, so items of users who have opted out since are dropped or anonymized.
+// If the client has dead letter sink and delivery fails again,
+// the sink receives new letter with incremented attempts counter.
+func Resubmit(ctx context.Context, cli Client, letter *DeadLetter) error {
+	if letter == nil {
+		return fmt.Errorf("dead letter is nil")
+	}
+
+	ctx = context.WithValue(ctx, attemptsKey{}, letter.Attempts)
+
+	endpoint := trimEndpointPrefix(letter.Endpoint)
+
+	switch endpoint {
+	case "track#live-event", "track#live-event-deduplicate":
+		if len(letter.Events) != 1 {
+			return fmt.Errorf("%s: expected single event, actual %d", letter.Endpoint, len(letter.Events))
+		}
+
+		if endpoint == "track#live-event" {
+			return cli.Track(ctx, letter.Events[0])
+		}
+
+		return cli.TrackDeduplicate(ctx, letter.Events[0])
+	case "track#past-events-batch":
+		return cli.TrackBatch(ctx, letter.Events)
+	case "engage#profile-batch-update":
+		return cli.EngageBatch(ctx, letter.Profiles)
+	}
+
+	if !strings.HasPrefix(endpoint, "engage#") {
+		return fmt.Errorf("unknown endpoint %q", letter.Endpoint)
+	}
+
+	if len(letter.Profiles) != 1 {
+		return fmt.Errorf("%s: expected single profile action, actual %d", letter.Endpoint, len(letter.Profiles))
+	}
+
+	return cli.Engage(ctx, letter.Profiles[0])
+}
+
+// trimEndpointPrefix removes path prefix of server URL from endpoint name, like `mp/track#live-event`.
+func trimEndpointPrefix(name string) string {
+	fragment := ""
+	if i := strings.Index(name, "#"); i >= 0 {
+		name, fragment = name[:i], name[i:]
+	}
+
+	return path.Base(name) + fragment
+}
@@ -0,0 +1,243 @@
+package ingestion_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+func Test_Client_dead_letters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.ndjson")
+
+	sink, err := ingestion.NewFileDeadLetterSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	available := false
+	doer := HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+		if !available {
+			return nil, errors.New("connection refused")
+		}
+
+		return ResponseStatus(http.StatusOK, req), nil
+	})
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(doer),
+		ingestion.WithDeadLetterSink(sink),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.TrackBatch(context.Background(), []*event.Data{{Event: "a"}, {Event: "b"}}); err == nil {
+		t.Fatal("expected delivery error")
+	}
+
+	err = cli.Engage(context.Background(), &profile.NumberAdd{DistinctID: "u", Add: map[string]interface{}{"n": 1}})
+	if err == nil {
+		t.Fatal("expected delivery error")
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	letters := readDeadLetters(t, path)
+	if len(letters) != 2 {
+		t.Fatalf("expected 2 dead letters, actual %d", len(letters))
+	}
+
+	if l := letters[0]; l.Endpoint != "track#past-events-batch" || len(l.Events) != 2 || l.Attempts != 1 || l.Err == nil {
+		t.Fatalf("unexpected dead letter: %+v", l)
+	}
+
+	if _, ok := letters[1].Profiles[0].(*profile.NumberAdd); !ok || letters[1].Endpoint != "engage#profile-numerical-add" {
+		t.Fatalf("unexpected dead letter: %+v", letters[1])
+	}
+
+	resubmitted := &DeadLetterSinkMock{}
+
+	cli, err = ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(doer),
+		ingestion.WithDeadLetterSink(resubmitted),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ingestion.Resubmit(context.Background(), cli, letters[0]); err == nil {
+		t.Fatal("expected delivery error")
+	}
+
+	if len(resubmitted.letters) != 1 || resubmitted.letters[0].Attempts != 2 {
+		t.Fatalf("unexpected dead letters after resubmission: %+v", resubmitted.letters)
+	}
+
+	available = true
+
+	for _, letter := range letters {
+		if err := ingestion.Resubmit(context.Background(), cli, letter); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_Resubmit_server_path_prefix(t *testing.T) {
+	sink := &DeadLetterSinkMock{}
+	paths := []string{}
+	available := false
+
+	cli, err := ingestion.NewClient(
+		"https://proxy.example.com/mp",
+		ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+			paths = append(paths, req.URL.Path)
+			if !available {
+				return nil, errors.New("connection refused")
+			}
+
+			return ResponseStatus(http.StatusOK, req), nil
+		})),
+		ingestion.WithDeadLetterSink(sink),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Track(context.Background(), &event.Data{Event: "a"}); err == nil {
+		t.Fatal("expected delivery error")
+	}
+
+	if len(sink.letters) != 1 || sink.letters[0].Endpoint != "track#live-event" {
+		t.Fatalf("unexpected dead letters: %+v", sink.letters)
+	}
+
+	available = true
+	letters := []*ingestion.DeadLetter{
+		sink.letters[0],
+		{Endpoint: "mp/track#live-event", Events: []*event.Data{{Event: "b"}}},
+	}
+
+	for i, letter := range letters {
+		if err := ingestion.Resubmit(context.Background(), cli, letter); err != nil {
+			t.Fatalf("[#%d] %s", i, err)
+		}
+	}
+
+	for i, p := range paths {
+		if p != "/mp/track" {
+			t.Fatalf("[#%d] unexpected path %q", i, p)
+		}
+	}
+}
+
+func Test_Client_dead_letters_prepared_items(t *testing.T) {
+	sink := &DeadLetterSinkMock{}
+	posted := []string{}
+	available := false
+	intercepted := 0
+
+	timers := ingestion.NewEventTimers(time.Minute)
+	super := ingestion.NewSuperProperties()
+	super.Register(event.CustomProperties{"app": "web"})
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+			if err := req.ParseForm(); err != nil {
+				return nil, err
+			}
+
+			posted = append(posted, req.PostForm.Get("data"))
+			if !available {
+				return nil, errors.New("connection refused")
+			}
+
+			return ResponseStatus(http.StatusOK, req), nil
+		})),
+		ingestion.WithDeadLetterSink(sink),
+		ingestion.WithSuperProperties(super),
+		ingestion.WithEventTimers(timers),
+		ingestion.WithProjectToken("token", ingestion.RejectTokenMismatch),
+		ingestion.WithEventInterceptor(func(_ context.Context, data *event.Data) (*event.Data, error) {
+			intercepted++
+
+			return data, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timers.Start("u1", "import")
+
+	ctx := ingestion.ContextWithDistinctID(context.Background(), "u1")
+	if err := cli.Track(ctx, &event.Data{Event: "import"}); err == nil {
+		t.Fatal("expected delivery error")
+	}
+
+	if len(sink.letters) != 1 || len(sink.letters[0].Events) != 1 {
+		t.Fatalf("unexpected dead letters: %+v", sink.letters)
+	}
+
+	p := sink.letters[0].Events[0].Properties
+	if _, ok := p.CustomProperties[ingestion.DurationProperty]; !ok ||
+		p.DistinctID != "u1" || p.Token != "token" || p.CustomProperties["app"] != "web" {
+		t.Fatalf("dead letter does not keep posted event: %+v", p)
+	}
+
+	available = true
+	super.Unregister("app")
+
+	if err := ingestion.Resubmit(context.Background(), cli, sink.letters[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posted) != 2 || posted[0] != posted[1] || intercepted != 1 {
+		t.Fatalf("resubmitted event differs from posted one, intercepted %d times: %v", intercepted, posted)
+	}
+}
+
+type DeadLetterSinkMock struct {
+	letters []*ingestion.DeadLetter
+}
+
+func (m *DeadLetterSinkMock) Put(_ context.Context, letter *ingestion.DeadLetter) error {
+	m.letters = append(m.letters, letter)
+
+	return nil
+}
+
+func readDeadLetters(t *testing.T, path string) []*ingestion.DeadLetter {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	letters := []*ingestion.DeadLetter{}
+
+	err = ingestion.ReadDeadLetters(f, func(letter *ingestion.DeadLetter) error {
+		letters = append(letters, letter)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return letters
+}
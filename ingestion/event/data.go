@@ -4,6 +4,7 @@ package event
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"time"
 )
 
@@ -146,13 +147,14 @@ func (p *Properties) UnmarshalJSON(raw []byte) error {
 		return err
 	}
 
-	var unix int64
+	// JavaScript SDK sends fractional seconds, milliseconds are kept.
+	var unix float64
 	if err := unmarshal("time", &unix); err != nil {
 		return err
 	}
 
 	if unix != 0 {
-		p.Time = time.Unix(unix, 0).UTC()
+		p.Time = time.Unix(0, int64(math.Round(unix*1e3))*int64(time.Millisecond)).UTC()
 	}
 
 	if err := unmarshal("token", &p.Token); err != nil {
@@ -97,3 +97,29 @@ func TestData_json_schema(t *testing.T) {
 		}
 	}
 }
+
+func TestProperties_fractional_time(t *testing.T) {
+	cases := []struct {
+		raw      string
+		expected time.Time
+	}{
+		{`{"time":1700000000}`, time.Unix(1700000000, 0).UTC()},
+		{`{"time":1700000000.123}`, time.Unix(1700000000, 123*int64(time.Millisecond)).UTC()},
+		{`{"time":0}`, time.Time{}},
+	}
+
+	for i, c := range cases {
+		p := event.Properties{}
+		if err := json.Unmarshal([]byte(c.raw), &p); err != nil {
+			t.Fatalf("[#%d] %s", i, err)
+		}
+
+		if !p.Time.Equal(c.expected) {
+			t.Fatalf("[#%d] expected time: %v, actual: %v", i, c.expected, p.Time)
+		}
+	}
+
+	if err := json.Unmarshal([]byte(`{"time":"now"}`), &event.Properties{}); err == nil {
+		t.Fatal("expected error for non-numeric time")
+	}
+}
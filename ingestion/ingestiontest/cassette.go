@@ -0,0 +1,329 @@
+package ingestiontest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/internal/form"
+	"github.com/wtask-go/mixpanel/internal/redact"
+)
+
+// Cassette is the list of recorded HTTP exchanges between the client and Mixpanel.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Interaction is single recorded HTTP exchange.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request"`
+	Response CassetteResponse `json:"response"`
+}
+
+// CassetteRequest is recorded request with decoded `data` JSON and scrubbed tokens and secrets.
+type CassetteRequest struct {
+	Method string `json:"method"`
+	// Endpoint is path and fragment of request URL, e.g. `/track#live-event`.
+	Endpoint string `json:"endpoint"`
+	// Form contains query and body values except `data`.
+	Form map[string]string `json:"form,omitempty"`
+	Data json.RawMessage   `json:"data,omitempty"`
+}
+
+// CassetteResponse is recorded response or transport error.
+type CassetteResponse struct {
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body,omitempty"`
+	Err         string `json:"error,omitempty"`
+}
+
+// LoadCassette reads cassette from JSON file.
+func LoadCassette(path string) (*Cassette, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cassette: %w", err)
+	}
+
+	cassette := &Cassette{}
+	if err := json.Unmarshal(raw, cassette); err != nil {
+		return nil, fmt.Errorf("decode cassette %s: %w", path, err)
+	}
+
+	return cassette, nil
+}
+
+// Save writes cassette to JSON file.
+func (c *Cassette) Save(path string) error {
+	raw, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode cassette: %w", err)
+	}
+
+	if err := ioutil.WriteFile(path, append(raw, '\n'), 0o600); err != nil {
+		return fmt.Errorf("write cassette: %w", err)
+	}
+
+	return nil
+}
+
+// CassetteRecorder is HTTP transport which passes requests to the next HTTPDoer and records exchanges.
+// CassetteRecorder implements both ingestion.HTTPDoer and http.RoundTripper interfaces.
+type CassetteRecorder struct {
+	next ingestion.HTTPDoer
+
+	mu       sync.Mutex
+	cassette Cassette
+}
+
+// NewCassetteRecorder builds recorder of exchanges with next HTTPDoer.
+// If next is nil, http.DefaultClient is used.
+func NewCassetteRecorder(next ingestion.HTTPDoer) *CassetteRecorder {
+	if next == nil {
+		next = http.DefaultClient
+	}
+
+	return &CassetteRecorder{next: next}
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (r *CassetteRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.Do(req)
+}
+
+// Do implements ingestion.HTTPDoer interface.
+func (r *CassetteRecorder) Do(req *http.Request) (*http.Response, error) {
+	interaction := &Interaction{}
+
+	var err error
+	if interaction.Request, err = recordRequest(req); err != nil {
+		return nil, err
+	}
+
+	resp, err := r.next.Do(req)
+	if err != nil {
+		interaction.Response.Err = err.Error()
+		r.add(interaction)
+
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	interaction.Response = CassetteResponse{
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(body),
+	}
+	r.add(interaction)
+
+	return resp, nil
+}
+
+func (r *CassetteRecorder) add(interaction *Interaction) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+}
+
+// Cassette returns recorded exchanges.
+func (r *CassetteRecorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return &Cassette{Interactions: append([]*Interaction{}, r.cassette.Interactions...)}
+}
+
+// Save writes recorded exchanges to JSON file.
+func (r *CassetteRecorder) Save(path string) error {
+	return r.Cassette().Save(path)
+}
+
+// CassetteReplayer is HTTP transport which responds with recorded exchanges without network access.
+// Request matches interaction by method, endpoint, form values and normalized `data` JSON,
+// where tokens, secrets and VolatileProperties of events are ignored.
+// Every interaction is replayed once, in order of recording.
+// CassetteReplayer implements both ingestion.HTTPDoer and http.RoundTripper interfaces.
+type CassetteReplayer struct {
+	mu           sync.Mutex
+	interactions []*Interaction
+	played       []bool
+}
+
+// NewCassetteReplayer builds replayer of cassette interactions.
+func NewCassetteReplayer(cassette *Cassette) *CassetteReplayer {
+	interactions := []*Interaction{}
+	if cassette != nil {
+		interactions = append(interactions, cassette.Interactions...)
+	}
+
+	return &CassetteReplayer{interactions: interactions, played: make([]bool, len(interactions))}
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (r *CassetteReplayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	return r.Do(req)
+}
+
+// Do implements ingestion.HTTPDoer interface.
+// Returns error if there is no matching interaction.
+func (r *CassetteReplayer) Do(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	key := recorded.key()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, interaction := range r.interactions {
+		if r.played[i] || interaction.Request.key() != key {
+			continue
+		}
+
+		r.played[i] = true
+
+		if interaction.Response.Err != "" {
+			return nil, errors.New(interaction.Response.Err)
+		}
+
+		return interaction.Response.response(req), nil
+	}
+
+	return nil, fmt.Errorf("no recorded interaction for %s %s", recorded.Method, recorded.Endpoint)
+}
+
+// Unplayed returns interactions which have not been replayed yet.
+func (r *CassetteReplayer) Unplayed() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unplayed := []*Interaction{}
+
+	for i, interaction := range r.interactions {
+		if !r.played[i] {
+			unplayed = append(unplayed, interaction)
+		}
+	}
+
+	return unplayed
+}
+
+// recordRequest decodes request without consuming its body.
+func recordRequest(req *http.Request) (CassetteRequest, error) {
+	recorded := CassetteRequest{Method: req.Method, Endpoint: req.URL.Path}
+	if req.URL.Fragment != "" {
+		recorded.Endpoint += "#" + req.URL.Fragment
+	}
+
+	values := req.URL.Query()
+
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := ioutil.ReadAll(req.Body)
+		_ = req.Body.Close()
+
+		if err != nil {
+			return recorded, fmt.Errorf("read request: %w", err)
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		parsed, err := url.ParseQuery(string(body))
+		if err != nil {
+			return recorded, fmt.Errorf("parse request form: %w", err)
+		}
+
+		for name := range parsed {
+			values.Set(name, parsed.Get(name))
+		}
+	}
+
+	for name := range values {
+		value := values.Get(name)
+
+		if name == "data" {
+			if data, err := scrubData(value); err == nil {
+				recorded.Data = data
+
+				continue
+			}
+		}
+
+		if redact.IsSensitive(name) {
+			value = redact.Placeholder
+		}
+
+		if recorded.Form == nil {
+			recorded.Form = map[string]string{}
+		}
+
+		recorded.Form[name] = value
+	}
+
+	return recorded, nil
+}
+
+// scrubData decodes `data` value and replaces tokens and secrets.
+func scrubData(value string) (json.RawMessage, error) {
+	raw, err := form.DecodeData(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(redact.JSON(data))
+}
+
+// key returns normalized representation of request to match interactions.
+func (r *CassetteRequest) key() string {
+	var data interface{}
+	if len(r.Data) > 0 && json.Unmarshal(r.Data, &data) == nil {
+		data = withoutVolatile(data)
+	}
+
+	// JSON encoding sorts map keys
+	key, _ := json.Marshal([]interface{}{r.Method, r.Endpoint, r.Form, data})
+
+	return string(key)
+}
+
+// withoutVolatile removes VolatileProperties from events.
+func withoutVolatile(data interface{}) interface{} {
+	switch v := data.(type) {
+	case []interface{}:
+		for _, item := range v {
+			withoutVolatile(item)
+		}
+	case map[string]interface{}:
+		if properties, ok := v["properties"].(map[string]interface{}); ok {
+			for _, name := range VolatileProperties {
+				delete(properties, name)
+			}
+		}
+	}
+
+	return data
+}
+
+func (r *CassetteResponse) response(req *http.Request) *http.Response {
+	return makeResponse(req, r.Status, r.ContentType, r.Body)
+}
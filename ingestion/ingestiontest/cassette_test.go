@@ -0,0 +1,85 @@
+package ingestiontest_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+func TestCassette_record_replay(t *testing.T) {
+	const token = "secret-project-token"
+
+	calls := func(cli ingestion.Client) []error {
+		ctx := context.Background()
+
+		return []error{
+			cli.Track(ctx, &event.Data{
+				Event:      "login",
+				Properties: event.Properties{Token: token, DistinctID: "u1", Time: time.Now()},
+			}),
+			cli.Track(ctx, &event.Data{Event: "login", Properties: event.Properties{Token: "wrong"}}),
+			cli.Engage(ctx, &profile.Set{Token: token, DistinctID: "u1", Set: map[string]interface{}{"plan": "free"}}),
+		}
+	}
+
+	server := httptest.NewServer(ingestiontest.NewEmulator(ingestiontest.WithProjectToken(token)))
+	defer server.Close()
+
+	recorder := ingestiontest.NewCassetteRecorder(server.Client())
+
+	cli, err := ingestion.NewClient(server.URL, ingestion.WithHTTPDoer(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := calls(cli)
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(raw), token) || !strings.Contains(string(raw), `"event": "login"`) {
+		t.Fatalf("unexpected cassette:\n%s", raw)
+	}
+
+	cassette, err := ingestiontest.LoadCassette(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayer := ingestiontest.NewCassetteReplayer(cassette)
+
+	cli, err = ingestion.NewClient("https://api.mixpanel.com", ingestion.WithHTTPDoer(replayer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, err := range calls(cli) {
+		if (err == nil) != (recorded[i] == nil) {
+			t.Fatalf("[#%d] recorded error: %v, replayed: %v", i, recorded[i], err)
+		}
+	}
+
+	if unplayed := replayer.Unplayed(); len(unplayed) != 0 {
+		t.Fatalf("unexpected unplayed interactions: %d", len(unplayed))
+	}
+
+	if err := cli.Track(context.Background(), &event.Data{Event: "login"}); err == nil {
+		t.Fatal("expected error for unrecorded request")
+	}
+}
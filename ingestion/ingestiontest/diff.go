@@ -0,0 +1,155 @@
+package ingestiontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+// VolatileProperties are event properties ignored by DiffEvents and AssertEvents by default.
+var VolatileProperties = []string{"$insert_id", "time"}
+
+// TB is the subset of testing.TB required for assertions.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertEvents reports test error if actual events differ from expected ones.
+// Properties listed in VolatileProperties and specified ignored properties are not compared.
+func AssertEvents(t TB, expected, actual []*event.Data, ignore ...string) {
+	t.Helper()
+
+	if diff := DiffEvents(expected, actual, ignore...); diff != "" {
+		t.Errorf("events mismatch:\n%s", diff)
+	}
+}
+
+// DiffEvents returns human-readable difference between expected and actual events
+// or empty string if they are equal. Events are compared by JSON representation, so numeric types do not matter.
+// Properties listed in VolatileProperties and specified ignored properties are not compared.
+func DiffEvents(expected, actual []*event.Data, ignore ...string) string {
+	lines := []string{}
+
+	if len(expected) != len(actual) {
+		lines = append(lines, fmt.Sprintf("length: expected %d, actual %d", len(expected), len(actual)))
+	}
+
+	for i := 0; i < len(expected) && i < len(actual); i++ {
+		for _, line := range diffEvent(expected[i], actual[i], ignore) {
+			lines = append(lines, fmt.Sprintf("[#%d] %s", i, line))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// DiffEvent returns human-readable difference between expected and actual event
+// or empty string if they are equal. See DiffEvents.
+func DiffEvent(expected, actual *event.Data, ignore ...string) string {
+	return strings.Join(diffEvent(expected, actual, ignore), "\n")
+}
+
+func diffEvent(expected, actual *event.Data, ignore []string) []string {
+	e, err := normalizeEvent(expected, ignore)
+	if err != nil {
+		return []string{fmt.Sprintf("expected: %s", err)}
+	}
+
+	a, err := normalizeEvent(actual, ignore)
+	if err != nil {
+		return []string{fmt.Sprintf("actual: %s", err)}
+	}
+
+	return diffValues("", e, a)
+}
+
+// normalizeEvent converts event to its JSON representation without ignored properties.
+func normalizeEvent(data *event.Data, ignore []string) (interface{}, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+
+	if properties, ok := obj["properties"].(map[string]interface{}); ok {
+		for _, name := range append(append([]string{}, VolatileProperties...), ignore...) {
+			delete(properties, name)
+		}
+	}
+
+	return obj, nil
+}
+
+func diffValues(path string, expected, actual interface{}) []string {
+	e, eok := expected.(map[string]interface{})
+	a, aok := actual.(map[string]interface{})
+
+	if !eok || !aok {
+		if reflect.DeepEqual(expected, actual) {
+			return nil
+		}
+
+		return []string{fmt.Sprintf("%s: expected %s, actual %s", path, jsonString(expected), jsonString(actual))}
+	}
+
+	keys := map[string]bool{}
+	for k := range e {
+		keys[k] = true
+	}
+
+	for k := range a {
+		keys[k] = true
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+
+	sort.Strings(sorted)
+
+	lines := []string{}
+
+	for _, k := range sorted {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+
+		ev, eok := e[k]
+		av, aok := a[k]
+
+		switch {
+		case !aok:
+			lines = append(lines, fmt.Sprintf("%s: expected %s, actual is missing", p, jsonString(ev)))
+		case !eok:
+			lines = append(lines, fmt.Sprintf("%s: unexpected %s", p, jsonString(av)))
+		default:
+			lines = append(lines, diffValues(p, ev, av)...)
+		}
+	}
+
+	return lines
+}
+
+func jsonString(v interface{}) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+
+	return string(raw)
+}
@@ -0,0 +1,383 @@
+package ingestiontest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/internal/form"
+)
+
+// Emulator is in-memory stand-in for Mixpanel Ingestion API which serves `/track` and `/engage` endpoints.
+// It supports `data` as JSON object, JSON array or base64-encoded JSON, and `verbose` flag.
+// Events are deduplicated by event name, distinct_id, time and $insert_id.
+// Profile actions are applied to stored profiles with Mixpanel semantics.
+// Use it with httptest.NewServer to run integration tests.
+type Emulator struct {
+	token string
+
+	mu       sync.Mutex
+	events   []*event.Data
+	inserted map[string]bool
+	profiles map[string]map[string]interface{}
+}
+
+// EmulatorOption customizes Emulator.
+type EmulatorOption func(*Emulator)
+
+// WithProjectToken makes Emulator to reject items with other project token.
+func WithProjectToken(token string) EmulatorOption {
+	return func(e *Emulator) {
+		e.token = token
+	}
+}
+
+// NewEmulator builds empty Emulator.
+func NewEmulator(options ...EmulatorOption) *Emulator {
+	e := &Emulator{}
+	for _, option := range options {
+		option(e)
+	}
+
+	e.Reset()
+
+	return e
+}
+
+// Reset removes all stored events and profiles.
+func (e *Emulator) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.events = nil
+	e.inserted = map[string]bool{}
+	e.profiles = map[string]map[string]interface{}{}
+}
+
+// Events returns stored events in order of arrival.
+func (e *Emulator) Events() []*event.Data {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return copyEvents(e.events)
+}
+
+// Profile returns copy of stored profile properties.
+func (e *Emulator) Profile(distinctID string) (map[string]interface{}, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	properties, ok := e.profiles[distinctID]
+	if !ok {
+		return nil, false
+	}
+
+	return copyValue(properties).(map[string]interface{}), true
+}
+
+// DistinctIDs returns sorted distinct IDs of stored profiles.
+func (e *Emulator) DistinctIDs() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	ids := make([]string, 0, len(e.profiles))
+	for id := range e.profiles {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// ServeHTTP implements http.Handler interface.
+func (e *Emulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		e.respond(w, r, err)
+
+		return
+	}
+
+	items, _, err := form.DecodeItems(r.Form.Get("data"))
+	if err != nil {
+		e.respond(w, r, err)
+
+		return
+	}
+
+	switch r.URL.Path {
+	default:
+		http.NotFound(w, r)
+
+		return
+	case "/track", "/track/":
+		err = e.track(items)
+	case "/engage", "/engage/":
+		err = e.engage(items)
+	}
+
+	e.respond(w, r, err)
+}
+
+// respond writes response according to `verbose` flag.
+func (*Emulator) respond(w http.ResponseWriter, r *http.Request, err error) {
+	status := 1
+	if err != nil {
+		status = 0
+	}
+
+	if r.Form.Get("verbose") != "1" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = fmt.Fprint(w, status)
+
+		return
+	}
+
+	response := struct {
+		Status int    `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}{Status: status}
+
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// track stores valid events; request succeeds if at least one event is valid.
+func (e *Emulator) track(items []json.RawMessage) error {
+	var lastErr error
+
+	accepted := 0
+	now := time.Now().UTC().Truncate(time.Second)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, item := range items {
+		data := &event.Data{}
+		if err := json.Unmarshal(item, data); err != nil {
+			lastErr = fmt.Errorf("event #%d: %w", i, err)
+
+			continue
+		}
+
+		if err := e.validateEvent(data); err != nil {
+			lastErr = fmt.Errorf("event #%d: %w", i, err)
+
+			continue
+		}
+
+		accepted++
+
+		if id := data.Properties.InsertID; id != "" {
+			key := fmt.Sprintf("%q %q %d %q", data.Event, data.Properties.DistinctID, data.Properties.Time.Unix(), id)
+			if e.inserted[key] {
+				continue
+			}
+
+			e.inserted[key] = true
+		}
+
+		if data.Properties.Time.IsZero() {
+			data.Properties.Time = now
+		}
+
+		e.events = append(e.events, data)
+	}
+
+	if accepted == 0 {
+		return lastErr
+	}
+
+	return nil
+}
+
+func (e *Emulator) validateEvent(data *event.Data) error {
+	switch {
+	case data.Event == "":
+		return fmt.Errorf("'event' must be a non-empty string")
+	case e.token != "" && data.Properties.Token != e.token:
+		return fmt.Errorf("invalid project token")
+	}
+
+	return nil
+}
+
+// engage applies profile actions, request fails on the first invalid action.
+func (e *Emulator) engage(items []json.RawMessage) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, item := range items {
+		if err := e.apply(item); err != nil {
+			return fmt.Errorf("profile action #%d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// apply changes stored profile according to action.
+func (e *Emulator) apply(raw json.RawMessage) error {
+	action := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &action); err != nil {
+		return err
+	}
+
+	token, _ := action["$token"].(string)
+	if e.token != "" && token != e.token {
+		return fmt.Errorf("invalid project token")
+	}
+
+	distinctID, _ := action["$distinct_id"].(string)
+	if distinctID == "" {
+		return fmt.Errorf("$distinct_id, missing or empty")
+	}
+
+	if _, ok := action["$delete"]; ok {
+		delete(e.profiles, distinctID)
+
+		return nil
+	}
+
+	// changes are applied to the copy to keep profile untouched on error
+	properties, _ := copyValue(e.profiles[distinctID]).(map[string]interface{})
+	operations := 0
+
+	for op, value := range action {
+		switch op {
+		default:
+			continue
+		case "$set", "$set_once", "$add", "$append", "$remove", "$unset":
+		}
+
+		if err := applyAction(properties, op, value); err != nil {
+			return err
+		}
+
+		operations++
+	}
+
+	if operations != 1 {
+		return fmt.Errorf("expected exactly one profile operation, actual %d", operations)
+	}
+
+	e.profiles[distinctID] = properties
+
+	return nil
+}
+
+func applyAction(properties map[string]interface{}, op string, value interface{}) error {
+	if op == "$unset" {
+		names, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("$unset must be a list")
+		}
+
+		for _, name := range names {
+			if n, ok := name.(string); ok {
+				delete(properties, n)
+			}
+		}
+
+		return nil
+	}
+
+	values, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s must be an object", op)
+	}
+
+	for name, v := range values {
+		if err := applyOperation(properties, op, name, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func applyOperation(properties map[string]interface{}, op, name string, value interface{}) error {
+	current, exists := properties[name]
+
+	switch op {
+	case "$set":
+		properties[name] = value
+	case "$set_once":
+		if !exists {
+			properties[name] = value
+		}
+	case "$add":
+		delta, ok := value.(float64)
+		if !ok {
+			return fmt.Errorf("$add %s: value is not a number", name)
+		}
+
+		sum, ok := current.(float64)
+		if exists && !ok {
+			return fmt.Errorf("$add %s: property is not a number", name)
+		}
+
+		properties[name] = sum + delta
+	case "$append":
+		list, ok := current.([]interface{})
+		if exists && !ok {
+			return fmt.Errorf("$append %s: property is not a list", name)
+		}
+
+		properties[name] = append(list, value)
+	case "$remove":
+		list, ok := current.([]interface{})
+		if !ok {
+			return nil
+		}
+
+		result := []interface{}{}
+
+		for _, item := range list {
+			if !reflect.DeepEqual(item, value) {
+				result = append(result, item)
+			}
+		}
+
+		properties[name] = result
+	}
+
+	return nil
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			c[k] = copyValue(item)
+		}
+
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, item := range v {
+			c[i] = copyValue(item)
+		}
+
+		return c
+	}
+
+	return value
+}
@@ -0,0 +1,165 @@
+package ingestiontest_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+func TestEmulator_events(t *testing.T) {
+	emulator := ingestiontest.NewEmulator(ingestiontest.WithProjectToken("token"))
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	cli, err := ingestion.NewClient(server.URL, ingestion.WithHTTPDoer(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	data := &event.Data{
+		Event:      "login",
+		Properties: event.Properties{InsertID: "id-1", DistinctID: "u1", Token: "token"},
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := cli.TrackDeduplicate(ctx, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = cli.TrackBatch(ctx, []*event.Data{
+		{Event: "view", Properties: event.Properties{DistinctID: "u1", Token: "token"}},
+		{Event: "view", Properties: event.Properties{DistinctID: "u1", Token: "wrong"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Track(ctx, &event.Data{Event: "view", Properties: event.Properties{Token: "wrong"}}); err == nil {
+		t.Fatal("expected error for wrong token")
+	}
+
+	events := emulator.Events()
+	if len(events) != 2 || events[0].Event != "login" || events[1].Event != "view" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	if events[1].Properties.Time.IsZero() {
+		t.Fatal("arrival time is not set")
+	}
+}
+
+func TestEmulator_profiles(t *testing.T) {
+	emulator := ingestiontest.NewEmulator()
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	cli, err := ingestion.NewClient(server.URL, ingestion.WithHTTPDoer(server.Client()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.EngageBatch(context.Background(), []profile.Mutator{
+		&profile.Set{DistinctID: "u1", Set: map[string]interface{}{"plan": "free", "tmp": 1}},
+		&profile.SetOnce{DistinctID: "u1", SetOnce: map[string]interface{}{"plan": "premium", "first": "x"}},
+		&profile.NumberAdd{DistinctID: "u1", Add: map[string]interface{}{"logins": 1}},
+		&profile.NumberAdd{DistinctID: "u1", Add: map[string]interface{}{"logins": 2}},
+		&profile.ListAppend{DistinctID: "u1", Append: map[string]interface{}{"roles": "user"}},
+		&profile.ListAppend{DistinctID: "u1", Append: map[string]interface{}{"roles": "admin"}},
+		&profile.ListRemove{DistinctID: "u1", Remove: map[string]interface{}{"roles": "user"}},
+		&profile.Unset{DistinctID: "u1", Unset: []string{"tmp"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, ok := emulator.Profile("u1")
+	if !ok {
+		t.Fatal("profile is not found")
+	}
+
+	expected := map[string]interface{}{
+		"plan":   "free",
+		"first":  "x",
+		"logins": 3.0,
+		"roles":  []interface{}{"admin"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected profile: %v, actual: %v", expected, actual)
+	}
+
+	err = cli.Engage(context.Background(), &profile.NumberAdd{DistinctID: "u1", Add: map[string]interface{}{"plan": 1}})
+	if err == nil {
+		t.Fatal("expected error to add number to string property")
+	}
+}
+
+func TestEmulator_sdk_request(t *testing.T) {
+	emulator := ingestiontest.NewEmulator()
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	data := base64.StdEncoding.EncodeToString([]byte(`{"event":"open","properties":{"token":"t"}}`))
+
+	resp, err := http.Get(server.URL + "/track?data=" + url.QueryEscape(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != "1" || resp.Header.Get("Content-Type") != "text/plain; charset=utf-8" {
+		t.Fatalf("unexpected response: %s %q", resp.Header.Get("Content-Type"), body)
+	}
+
+	if events := emulator.Events(); len(events) != 1 || events[0].Event != "open" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestEmulator_fractional_time(t *testing.T) {
+	emulator := ingestiontest.NewEmulator(ingestiontest.WithProjectToken("token"))
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	// mixpanel-js sends time as fractional seconds
+	data := base64.StdEncoding.EncodeToString([]byte(`[{"event":"$mp_web_page_view","properties":{` +
+		`"$current_url":"https://example.com/","mp_lib":"web","distinct_id":"$device:18b",` +
+		`"$insert_id":"r8kq3m9cz2x","token":"token","time":1700000000.123}}]`))
+
+	resp, err := http.PostForm(server.URL+"/track/?verbose=1", url.Values{"data": {data}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != `{"status":1}`+"\n" {
+		t.Fatalf("unexpected response: %q", body)
+	}
+
+	events := emulator.Events()
+	if len(events) != 1 || events[0].Properties.Time.UnixNano() != 1700000000123*int64(time.Millisecond) {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
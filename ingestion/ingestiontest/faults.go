@@ -0,0 +1,265 @@
+package ingestiontest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+)
+
+// Fault is the kind of failure injected by FaultInjector.
+type Fault int
+
+// Supported faults.
+const (
+	// NoFault passes request through.
+	NoFault Fault = iota
+	// FaultTooManyRequests responds with 429 status.
+	FaultTooManyRequests
+	// FaultServerError responds with 500 status.
+	FaultServerError
+	// FaultStatusZero responds with 200 status and `{"status": 0}` verbose response.
+	FaultStatusZero
+	// FaultMalformedJSON responds with 200 status and broken JSON body.
+	FaultMalformedJSON
+	// FaultSlowBody passes request through, but delays reading of response body.
+	FaultSlowBody
+	// FaultConnectionReset fails request with connection reset error.
+	FaultConnectionReset
+)
+
+// String implements fmt.Stringer interface.
+func (f Fault) String() string {
+	switch f {
+	case NoFault:
+		return "none"
+	case FaultTooManyRequests:
+		return "too-many-requests"
+	case FaultServerError:
+		return "server-error"
+	case FaultStatusZero:
+		return "status-zero"
+	case FaultMalformedJSON:
+		return "malformed-json"
+	case FaultSlowBody:
+		return "slow-body"
+	case FaultConnectionReset:
+		return "connection-reset"
+	}
+
+	return fmt.Sprintf("Fault(%d)", int(f))
+}
+
+// FaultRule describes when and which fault to inject.
+type FaultRule struct {
+	// Endpoint limits the rule to matching requests, empty value matches all requests.
+	// Value is path, fragment or both, for example "/engage", "#past-events-batch", "/track#live-event".
+	Endpoint string
+
+	// Sequence is list of faults for consecutive matching requests, NoFault passes the request.
+	// When sequence is exhausted, the rule starts over if Repeat is set, or stops injecting faults otherwise.
+	Sequence []Fault
+	Repeat   bool
+
+	// Fault is injected with Probability (0, 1] if Sequence is empty.
+	Fault       Fault
+	Probability float64
+
+	// Delay is duration of FaultSlowBody, default is 1 second.
+	Delay time.Duration
+}
+
+type faultRule struct {
+	FaultRule
+	path     string
+	fragment string
+	position int
+}
+
+func (r *faultRule) match(req *http.Request) bool {
+	return (r.path == "" || r.path == req.URL.Path) &&
+		(r.fragment == "" || r.fragment == req.URL.Fragment)
+}
+
+// next returns fault for matching request.
+func (r *faultRule) next(random *rand.Rand) Fault {
+	if len(r.Sequence) == 0 {
+		if random.Float64() < r.Probability {
+			return r.Fault
+		}
+
+		return NoFault
+	}
+
+	if r.position >= len(r.Sequence) {
+		if !r.Repeat {
+			return NoFault
+		}
+
+		r.position = 0
+	}
+
+	r.position++
+
+	return r.Sequence[r.position-1]
+}
+
+// FaultInjector is HTTP transport which injects faults to test resilience of the client and its callers.
+// Faults are chosen by the first matching rule which injects fault.
+// Random faults are reproducible for the same seed and the same order of requests.
+// FaultInjector implements both ingestion.HTTPDoer and http.RoundTripper interfaces.
+type FaultInjector struct {
+	next ingestion.HTTPDoer
+
+	mu       sync.Mutex
+	random   *rand.Rand
+	rules    []*faultRule
+	injected map[Fault]int
+}
+
+// NewFaultInjector builds injector which passes requests without faults to next HTTPDoer.
+// If next is nil, injector responds itself with successful verbose response.
+func NewFaultInjector(next ingestion.HTTPDoer, seed int64, rules ...FaultRule) *FaultInjector {
+	f := &FaultInjector{
+		next:     next,
+		random:   rand.New(rand.NewSource(seed)),
+		injected: map[Fault]int{},
+	}
+
+	for _, rule := range rules {
+		r := &faultRule{FaultRule: rule}
+		r.path, r.fragment = rule.Endpoint, ""
+
+		if i := strings.Index(rule.Endpoint, "#"); i >= 0 {
+			r.path, r.fragment = rule.Endpoint[:i], rule.Endpoint[i+1:]
+		}
+
+		if r.Delay <= 0 {
+			r.Delay = time.Second
+		}
+
+		f.rules = append(f.rules, r)
+	}
+
+	return f
+}
+
+// Injected returns number of injected faults by kind.
+func (f *FaultInjector) Injected() map[Fault]int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	injected := make(map[Fault]int, len(f.injected))
+	for k, v := range f.injected {
+		injected[k] = v
+	}
+
+	return injected
+}
+
+// choose returns fault for request and its rule.
+func (f *FaultInjector) choose(req *http.Request) (Fault, *faultRule) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, rule := range f.rules {
+		if !rule.match(req) {
+			continue
+		}
+
+		if fault := rule.next(f.random); fault != NoFault {
+			f.injected[fault]++
+
+			return fault, rule
+		}
+	}
+
+	return NoFault, nil
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (f *FaultInjector) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f.Do(req)
+}
+
+// Do implements ingestion.HTTPDoer interface.
+func (f *FaultInjector) Do(req *http.Request) (*http.Response, error) {
+	fault, rule := f.choose(req)
+
+	switch fault {
+	case NoFault, FaultSlowBody:
+	case FaultTooManyRequests:
+		return makeResponse(req, http.StatusTooManyRequests, "text/plain", "Too Many Requests"), nil
+	case FaultServerError:
+		return makeResponse(req, http.StatusInternalServerError, "text/plain", "Internal Server Error"), nil
+	case FaultStatusZero:
+		return makeResponse(req, http.StatusOK, "application/json", `{"status":0,"error":"injected fault"}`), nil
+	case FaultMalformedJSON:
+		return makeResponse(req, http.StatusOK, "application/json", `{"status":1,`), nil
+	case FaultConnectionReset:
+		return nil, &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	}
+
+	resp := okResponse(req)
+
+	if f.next != nil {
+		var err error
+		if resp, err = f.next.Do(req); err != nil {
+			return nil, err
+		}
+	}
+
+	if fault == FaultSlowBody {
+		resp.Body = &slowBody{ReadCloser: resp.Body, delay: rule.Delay, ctx: req.Context()}
+	}
+
+	return resp, nil
+}
+
+func makeResponse(req *http.Request, status int, contentType, body string) *http.Response {
+	return &http.Response{
+		Request:       req,
+		Header:        http.Header{"Content-Type": []string{contentType}},
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		ContentLength: int64(len(body)),
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// slowBody delays the first read until delay is passed or request context is done.
+type slowBody struct {
+	io.ReadCloser
+	delay   time.Duration
+	ctx     context.Context
+	delayed bool
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	if !b.delayed {
+		b.delayed = true
+		timer := time.NewTimer(b.delay)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-b.ctx.Done():
+			return 0, b.ctx.Err()
+		}
+	}
+
+	return b.ReadCloser.Read(p)
+}
@@ -0,0 +1,126 @@
+package ingestiontest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+)
+
+func TestFaultInjector_sequence(t *testing.T) {
+	injector := ingestiontest.NewFaultInjector(nil, 1, ingestiontest.FaultRule{
+		Endpoint: "#past-events-batch",
+		Sequence: []ingestiontest.Fault{
+			ingestiontest.FaultServerError,
+			ingestiontest.FaultStatusZero,
+			ingestiontest.FaultMalformedJSON,
+			ingestiontest.NoFault,
+		},
+	})
+
+	cli, err := ingestion.NewClient("https://api.mixpanel.com", ingestion.WithHTTPDoer(injector))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	batch := []*event.Data{{Event: "test"}}
+
+	for i, expectErr := range []bool{true, true, true, false, false} {
+		if err := cli.Track(ctx, batch[0]); err != nil {
+			t.Fatalf("[#%d] unexpected error of live event: %v", i, err)
+		}
+
+		if err := cli.TrackBatch(ctx, batch); (err != nil) != expectErr {
+			t.Fatalf("[#%d] expected error: %v, actual: %v", i, expectErr, err)
+		}
+	}
+
+	expected := map[ingestiontest.Fault]int{
+		ingestiontest.FaultServerError:   1,
+		ingestiontest.FaultStatusZero:    1,
+		ingestiontest.FaultMalformedJSON: 1,
+	}
+	if actual := injector.Injected(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected faults: %v, actual: %v", expected, actual)
+	}
+}
+
+func TestFaultInjector_probability(t *testing.T) {
+	rule := ingestiontest.FaultRule{Fault: ingestiontest.FaultTooManyRequests, Probability: 0.5}
+	run := func(seed int64) []bool {
+		injector := ingestiontest.NewFaultInjector(nil, seed, rule)
+		failures := []bool{}
+
+		for i := 0; i < 20; i++ {
+			req, _ := http.NewRequest(http.MethodPost, "https://api.mixpanel.com/track", nil)
+
+			resp, err := injector.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp.Body.Close()
+			failures = append(failures, resp.StatusCode == http.StatusTooManyRequests)
+		}
+
+		return failures
+	}
+
+	first, second := run(42), run(42)
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("faults are not reproducible: %v, %v", first, second)
+	}
+
+	injected := 0
+
+	for _, failed := range first {
+		if failed {
+			injected++
+		}
+	}
+
+	if injected == 0 || injected == len(first) {
+		t.Fatalf("unexpected number of faults: %d of %d", injected, len(first))
+	}
+}
+
+func TestFaultInjector_transport(t *testing.T) {
+	injector := ingestiontest.NewFaultInjector(nil, 1,
+		ingestiontest.FaultRule{Endpoint: "/engage", Sequence: []ingestiontest.Fault{ingestiontest.FaultConnectionReset}},
+		ingestiontest.FaultRule{
+			Endpoint: "/track",
+			Sequence: []ingestiontest.Fault{ingestiontest.FaultSlowBody},
+			Repeat:   true,
+			Delay:    time.Minute,
+		},
+	)
+
+	httpc := &http.Client{Transport: injector}
+
+	_, err := httpc.Post("https://api.mixpanel.com/engage", "text/plain", nil)
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("expected connection reset, actual: %v", err)
+	}
+
+	cli, err := ingestion.NewClient("https://api.mixpanel.com", ingestion.WithHTTPDoer(httpc))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err = cli.Track(ctx, &event.Data{Event: "test"})
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Fatalf("expected deadline exceeded, actual: %v", err)
+	}
+}
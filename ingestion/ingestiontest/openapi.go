@@ -0,0 +1,281 @@
+package ingestiontest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/internal/assets"
+)
+
+// ContractError describes violation of Mixpanel Ingestion API specification.
+type ContractError struct {
+	Method string
+	URL    string
+	// Response is true when response violates specification, otherwise request does.
+	Response bool
+	Err      error
+}
+
+func (e *ContractError) Error() string {
+	subject := "request"
+	if e.Response {
+		subject = "response"
+	}
+
+	return fmt.Sprintf("%s %s: invalid %s: %s", e.Method, e.URL, subject, e.Err)
+}
+
+// Unwrap returns underlying validation error.
+func (e *ContractError) Unwrap() error {
+	return e.Err
+}
+
+// OpenAPIValidator is HTTP transport which validates every request and response
+// against embedded OpenAPI specification of Mixpanel Ingestion API.
+// Validator implements both ingestion.HTTPDoer and http.RoundTripper interfaces.
+// Requests are routed by path and fragment, as ingestion.Client builds them, e.g. `/track#live-event`,
+// server host and path prefix are ignored, so validator can be used with local servers and proxies.
+type OpenAPIValidator struct {
+	next   ingestion.HTTPDoer
+	router routers.Router
+	server *url.URL
+}
+
+var registerOpenAPIDecoders sync.Once
+
+// NewOpenAPIValidator builds validator which passes valid requests to next HTTPDoer.
+// If next is nil, validator responds itself with successful verbose response.
+// To decode Mixpanel forms and plain text responses, validator globally registers
+// body decoders of `application/x-www-form-urlencoded` and `text/plain` in openapi3filter package.
+func NewOpenAPIValidator(next ingestion.HTTPDoer) (*OpenAPIValidator, error) {
+	registerOpenAPIDecoders.Do(func() {
+		openapi3.DefineIPv4Format()
+		openapi3.DefineIPv6Format()
+		openapi3filter.RegisterBodyDecoder("application/x-www-form-urlencoded", urlencodedBodyDecoder)
+		openapi3filter.RegisterBodyDecoder("text/plain", plainBodyDecoder)
+	})
+
+	spec := assets.MustCompileIngestionSpecification()
+	if len(spec.Servers) == 0 {
+		return nil, fmt.Errorf("OpenAPI specification has no servers")
+	}
+
+	server, err := url.Parse(spec.Servers[0].URL)
+	if err != nil {
+		return nil, fmt.Errorf("OpenAPI server: %w", err)
+	}
+
+	router, err := legacy.NewRouter(spec)
+	if err != nil {
+		return nil, fmt.Errorf("OpenAPI router: %w", err)
+	}
+
+	return &OpenAPIValidator{next: next, router: router, server: server}, nil
+}
+
+// RoundTrip implements http.RoundTripper interface.
+func (v *OpenAPIValidator) RoundTrip(req *http.Request) (*http.Response, error) {
+	return v.Do(req)
+}
+
+// Do implements ingestion.HTTPDoer interface.
+// Returns *ContractError if request or response violates specification.
+func (v *OpenAPIValidator) Do(req *http.Request) (*http.Response, error) {
+	violation := func(response bool, err error) error {
+		return &ContractError{Method: req.Method, URL: req.URL.String(), Response: response, Err: err}
+	}
+
+	// router matches servers declared in specification, path prefix of proxy is dropped
+	routed := req.Clone(req.Context())
+	routed.URL.Scheme, routed.URL.Host = v.server.Scheme, v.server.Host
+	routed.URL.Path, routed.URL.RawPath = path.Join(v.server.Path, "/", path.Base(req.URL.Path)), ""
+
+	route, params, err := v.router.FindRoute(routed)
+	if err != nil {
+		return nil, violation(false, err)
+	}
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: params,
+		Route:      route,
+	}
+
+	if err := openapi3filter.ValidateRequest(req.Context(), input); err != nil {
+		return nil, violation(false, err)
+	}
+
+	if v.next == nil {
+		return okResponse(req), nil
+	}
+
+	resp, err := v.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 resp.StatusCode,
+		Header:                 resp.Header,
+		Body:                   ioutil.NopCloser(bytes.NewReader(body)),
+		Options:                &openapi3filter.Options{IncludeResponseStatus: true},
+	})
+	if err != nil {
+		return nil, violation(true, err)
+	}
+
+	return resp, nil
+}
+
+func okResponse(req *http.Request) *http.Response {
+	body := `{"status":1}`
+
+	return &http.Response{
+		Request:       req,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		ContentLength: int64(len(body)),
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+	}
+}
+
+// plainBodyDecoder decodes text/plain body as number when schema requires it.
+func plainBodyDecoder(
+	body io.Reader,
+	_ http.Header,
+	schema *openapi3.SchemaRef,
+	_ openapi3filter.EncodingFn,
+) (interface{}, error) {
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	text := string(data)
+	if schema == nil || schema.Value == nil {
+		return text, nil
+	}
+
+	switch schema.Value.Type {
+	case "integer", "number":
+		v, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q: %w", text, err)
+		}
+
+		return v, nil
+	}
+
+	return text, nil
+}
+
+// urlencodedBodyDecoder decodes Mixpanel form, where objects and arrays are passed as JSON strings.
+func urlencodedBodyDecoder(
+	body io.Reader,
+	_ http.Header,
+	schema *openapi3.SchemaRef,
+	_ openapi3filter.EncodingFn,
+) (interface{}, error) {
+	// Validate schema of request body.
+	// By the OpenAPI 3 specification request body's schema must have type "object".
+	// Properties of the schema describes individual parts of request body.
+	if schema.Value.Type != "object" {
+		return nil, errors.New("unsupported schema of request body")
+	}
+
+	// Parse form.
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := url.ParseQuery(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	// check schema for required fields
+	required := map[string]bool{}
+	for _, name := range schema.Value.Required {
+		required[name] = true
+	}
+
+	// Make an object from form body.
+	obj := make(map[string]interface{})
+
+	for name, prop := range schema.Value.Properties {
+		if _, ok := values[name]; !ok {
+			if required[name] {
+				return nil, fmt.Errorf("required field %s is missing", name)
+			}
+
+			continue
+		}
+
+		if obj[name], err = decodeFormValue(name, prop.Value.Type, values.Get(name)); err != nil {
+			return nil, err
+		}
+	}
+
+	return obj, nil
+}
+
+func decodeFormValue(name, typ, value string) (interface{}, error) {
+	switch typ {
+	case "object":
+		raw := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(value), &raw); err != nil {
+			return nil, fmt.Errorf("invalid object %s: %w", name, err)
+		}
+
+		return raw, nil
+	case "array":
+		raw := []interface{}{}
+		if err := json.Unmarshal([]byte(value), &raw); err != nil {
+			return nil, fmt.Errorf("invalid array %s: %w", name, err)
+		}
+
+		return raw, nil
+	case "integer":
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %s (%s): %w", name, value, err)
+		}
+
+		return v, nil
+	case "string":
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("unrecognized field type %q", typ)
+}
@@ -0,0 +1,80 @@
+package ingestiontest_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+type HTTPDoerMock func(*http.Request) (*http.Response, error)
+
+func (mock HTTPDoerMock) Do(req *http.Request) (*http.Response, error) {
+	return mock(req)
+}
+
+func TestOpenAPIValidator(t *testing.T) {
+	server := httptest.NewServer(ingestiontest.NewEmulator())
+	defer server.Close()
+
+	validator, err := ingestiontest.NewOpenAPIValidator(server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli, err := ingestion.NewClient(server.URL, ingestion.WithHTTPDoer(&http.Client{Transport: validator}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := cli.Track(ctx, &event.Data{Event: "valid", Properties: event.Properties{IP: "127.0.0.1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.Track(ctx, &event.Data{Event: "invalid", Properties: event.Properties{IP: "127:0:0:1"}})
+
+	contractErr := &ingestiontest.ContractError{}
+	if !errors.As(err, &contractErr) || contractErr.Response {
+		t.Fatalf("expected request contract error, actual: %v", err)
+	}
+
+	err = cli.Engage(ctx, &profile.Set{DistinctID: "u1", Set: map[string]interface{}{}})
+	if !errors.As(err, &contractErr) {
+		t.Fatalf("expected request contract error for empty $set, actual: %v", err)
+	}
+}
+
+func TestOpenAPIValidator_response(t *testing.T) {
+	validator, err := ingestiontest.NewOpenAPIValidator(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			Request:    req,
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"text/plain"}},
+			Body:       ioutil.NopCloser(strings.NewReader("2")),
+		}, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli, err := ingestion.NewClient("https://api.mixpanel.com", ingestion.WithHTTPDoer(validator))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.Track(context.Background(), &event.Data{Event: "test"})
+
+	contractErr := &ingestiontest.ContractError{}
+	if !errors.As(err, &contractErr) || !contractErr.Response {
+		t.Fatalf("expected response contract error, actual: %v", err)
+	}
+}
@@ -0,0 +1,346 @@
+// Package ingestiontest provides utilities to test code which uses Mixpanel Ingestion API client.
+package ingestiontest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+// Method is the name of ingestion.Client method.
+type Method string
+
+// Methods of ingestion.Client.
+const (
+	Track            Method = "Track"
+	TrackDeduplicate Method = "TrackDeduplicate"
+	TrackBatch       Method = "TrackBatch"
+	Engage           Method = "Engage"
+	EngageBatch      Method = "EngageBatch"
+)
+
+// Call describes single recorded call of the client.
+type Call struct {
+	Method   Method
+	Events   []*event.Data
+	Profiles []profile.Mutator
+	// Err is the error returned to the caller.
+	Err error
+}
+
+// FailureRule returns error to fail the call or nil to pass it.
+type FailureRule func(*Call) error
+
+// Recorder is in-memory implementation of ingestion.Client which records every call.
+// Recorded events are shallow copies with own CustomProperties and recorded profile actions
+// are shallow copies with own maps of properties, so caller may reuse passed values.
+// Recorder is safe for concurrent use.
+type Recorder struct {
+	mu    sync.Mutex
+	calls []*Call
+	rules []FailureRule
+}
+
+var _ ingestion.Client = (*Recorder)(nil)
+
+// NewRecorder builds empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// FailWhen registers rule to fail matching calls. Rules are checked in order of registration.
+func (r *Recorder) FailWhen(rule FailureRule) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rules = append(r.rules, rule)
+}
+
+// FailNext fails next n calls with specified error.
+func (r *Recorder) FailNext(n int, err error) {
+	r.FailWhen(func(*Call) error {
+		if n <= 0 {
+			return nil
+		}
+
+		n--
+
+		return err
+	})
+}
+
+// FailEvent fails every call which contains event with specified name.
+func (r *Recorder) FailEvent(name string, err error) {
+	r.FailWhen(func(c *Call) error {
+		for _, data := range c.Events {
+			if data != nil && data.Event == name {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Reset removes recorded calls and failure rules.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls, r.rules = nil, nil
+}
+
+func (r *Recorder) record(call *Call) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rule := range r.rules {
+		if call.Err = rule(call); call.Err != nil {
+			break
+		}
+	}
+
+	r.calls = append(r.calls, call)
+
+	return call.Err
+}
+
+// Track implements ingestion.Client interface.
+func (r *Recorder) Track(_ context.Context, data *event.Data) error {
+	if data == nil {
+		return fmt.Errorf("event object is nil")
+	}
+
+	return r.record(&Call{Method: Track, Events: copyEvents([]*event.Data{data})})
+}
+
+// TrackDeduplicate implements ingestion.Client interface.
+func (r *Recorder) TrackDeduplicate(_ context.Context, data *event.Data) error {
+	if data == nil {
+		return fmt.Errorf("event object is nil")
+	}
+
+	return r.record(&Call{Method: TrackDeduplicate, Events: copyEvents([]*event.Data{data})})
+}
+
+// TrackBatch implements ingestion.Client interface.
+func (r *Recorder) TrackBatch(_ context.Context, batch []*event.Data) error {
+	switch l := len(batch); {
+	case l == 0:
+		return fmt.Errorf("events batch is empty")
+	case l > ingestion.TrackBatchLimit:
+		return fmt.Errorf("events batch (%d) exceeds limit (%d)", l, ingestion.TrackBatchLimit)
+	}
+
+	return r.record(&Call{Method: TrackBatch, Events: copyEvents(batch)})
+}
+
+// Engage implements ingestion.Client interface.
+func (r *Recorder) Engage(_ context.Context, action profile.Mutator) error {
+	if action == nil {
+		return fmt.Errorf("engage action is nil")
+	}
+
+	return r.record(&Call{Method: Engage, Profiles: copyProfiles([]profile.Mutator{action})})
+}
+
+// EngageBatch implements ingestion.Client interface.
+func (r *Recorder) EngageBatch(_ context.Context, batch []profile.Mutator) error {
+	if len(batch) == 0 {
+		return fmt.Errorf("empty profiles batch")
+	}
+
+	return r.record(&Call{Method: EngageBatch, Profiles: copyProfiles(batch)})
+}
+
+// Calls returns all recorded calls including failed ones.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	calls := make([]Call, 0, len(r.calls))
+	for _, c := range r.calls {
+		calls = append(calls, *c)
+	}
+
+	return calls
+}
+
+// Events returns events of successful calls in order of tracking.
+func (r *Recorder) Events() []*event.Data {
+	return r.FilterEvents(func(*event.Data) bool { return true })
+}
+
+// FilterEvents returns events of successful calls accepted by filter.
+func (r *Recorder) FilterEvents(filter func(*event.Data) bool) []*event.Data {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := []*event.Data{}
+
+	for _, c := range r.calls {
+		if c.Err != nil {
+			continue
+		}
+
+		for _, data := range c.Events {
+			if data != nil && filter(data) {
+				events = append(events, data)
+			}
+		}
+	}
+
+	return events
+}
+
+// EventsByName returns successfully tracked events with specified name.
+func (r *Recorder) EventsByName(name string) []*event.Data {
+	return r.FilterEvents(func(data *event.Data) bool {
+		return data.Event == name
+	})
+}
+
+// EventsByDistinctID returns successfully tracked events of specified user.
+func (r *Recorder) EventsByDistinctID(distinctID string) []*event.Data {
+	return r.FilterEvents(func(data *event.Data) bool {
+		return data.Properties.DistinctID == distinctID
+	})
+}
+
+// EventsWithProperty returns successfully tracked events having custom property with specified value.
+func (r *Recorder) EventsWithProperty(name string, value interface{}) []*event.Data {
+	return r.FilterEvents(func(data *event.Data) bool {
+		v, ok := data.Properties.CustomProperties[name]
+
+		return ok && reflect.DeepEqual(v, value)
+	})
+}
+
+// Profiles returns profile actions of successful calls in order of engagement.
+func (r *Recorder) Profiles() []profile.Mutator {
+	return r.FilterProfiles(func(profile.Mutator) bool { return true })
+}
+
+// FilterProfiles returns profile actions of successful calls accepted by filter.
+func (r *Recorder) FilterProfiles(filter func(profile.Mutator) bool) []profile.Mutator {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	actions := []profile.Mutator{}
+
+	for _, c := range r.calls {
+		if c.Err != nil {
+			continue
+		}
+
+		for _, action := range c.Profiles {
+			if action != nil && filter(action) {
+				actions = append(actions, action)
+			}
+		}
+	}
+
+	return actions
+}
+
+// ProfilesByDistinctID returns successfully engaged profile actions of specified user.
+func (r *Recorder) ProfilesByDistinctID(distinctID string) []profile.Mutator {
+	return r.FilterProfiles(func(action profile.Mutator) bool {
+		return profile.DistinctID(action) == distinctID
+	})
+}
+
+func copyEvents(batch []*event.Data) []*event.Data {
+	events := make([]*event.Data, 0, len(batch))
+
+	for _, data := range batch {
+		if data == nil {
+			events = append(events, nil)
+
+			continue
+		}
+
+		c := *data
+		if data.Properties.CustomProperties != nil {
+			c.Properties.CustomProperties = event.CustomProperties{}
+			for k, v := range data.Properties.CustomProperties {
+				c.Properties.CustomProperties[k] = v
+			}
+		}
+
+		events = append(events, &c)
+	}
+
+	return events
+}
+
+func copyProfiles(batch []profile.Mutator) []profile.Mutator {
+	actions := make([]profile.Mutator, 0, len(batch))
+
+	for _, action := range batch {
+		actions = append(actions, copyProfile(action))
+	}
+
+	return actions
+}
+
+func copyProfile(action profile.Mutator) profile.Mutator {
+	switch a := action.(type) {
+	case *profile.Set:
+		c := *a
+		c.Set = copyMap(a.Set)
+
+		return &c
+	case *profile.SetOnce:
+		c := *a
+		c.SetOnce = copyMap(a.SetOnce)
+
+		return &c
+	case *profile.NumberAdd:
+		c := *a
+		c.Add = copyMap(a.Add)
+
+		return &c
+	case *profile.ListAppend:
+		c := *a
+		c.Append = copyMap(a.Append)
+
+		return &c
+	case *profile.ListRemove:
+		c := *a
+		c.Remove = copyMap(a.Remove)
+
+		return &c
+	case *profile.Unset:
+		c := *a
+		if a.Unset != nil {
+			c.Unset = append([]string{}, a.Unset...)
+		}
+
+		return &c
+	case *profile.Delete:
+		c := *a
+
+		return &c
+	}
+
+	return action
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
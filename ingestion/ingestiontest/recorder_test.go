@@ -0,0 +1,153 @@
+package ingestiontest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+func TestRecorder(t *testing.T) {
+	rec := ingestiontest.NewRecorder()
+	failure := errors.New("mixpanel is down")
+	rec.FailEvent("fail", failure)
+
+	ctx := context.Background()
+	_ = rec.Track(ctx, &event.Data{
+		Event: "login",
+		Properties: event.Properties{
+			DistinctID:       "u1",
+			CustomProperties: event.CustomProperties{"plan": "free"},
+		},
+	})
+	_ = rec.TrackBatch(ctx, []*event.Data{
+		{Event: "view", Properties: event.Properties{DistinctID: "u2"}},
+		{Event: "login", Properties: event.Properties{DistinctID: "u2"}},
+	})
+	_ = rec.Engage(ctx, &profile.Set{DistinctID: "u1", Set: map[string]interface{}{"plan": "free"}})
+
+	if err := rec.Track(ctx, &event.Data{Event: "fail"}); !errors.Is(err, failure) {
+		t.Fatalf("expected programmed failure, actual: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		events []*event.Data
+		count  int
+	}{
+		{"all", rec.Events(), 3},
+		{"by name", rec.EventsByName("login"), 2},
+		{"by distinct ID", rec.EventsByDistinctID("u2"), 2},
+		{"by property", rec.EventsWithProperty("plan", "free"), 1},
+		{"failed", rec.EventsByName("fail"), 0},
+	}
+
+	for _, c := range cases {
+		if len(c.events) != c.count {
+			t.Fatalf("%s: expected %d events, actual %d", c.name, c.count, len(c.events))
+		}
+	}
+
+	if len(rec.ProfilesByDistinctID("u1")) != 1 {
+		t.Fatalf("unexpected profiles: %+v", rec.Profiles())
+	}
+
+	if calls := rec.Calls(); len(calls) != 4 || calls[3].Err == nil {
+		t.Fatalf("unexpected calls: %+v", calls)
+	}
+
+	rec.FailNext(1, failure)
+
+	if err := rec.Track(ctx, &event.Data{Event: "login"}); !errors.Is(err, failure) {
+		t.Fatalf("expected programmed failure, actual: %v", err)
+	}
+
+	if err := rec.Track(ctx, &event.Data{Event: "login"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestRecorder_copies_profiles(t *testing.T) {
+	rec := ingestiontest.NewRecorder()
+	ctx := context.Background()
+
+	set := &profile.Set{DistinctID: "u1", Set: map[string]interface{}{"plan": "free"}}
+	unset := &profile.Unset{DistinctID: "u1", Unset: []string{"trial"}}
+
+	_ = rec.Engage(ctx, set)
+	_ = rec.EngageBatch(ctx, []profile.Mutator{unset})
+
+	set.DistinctID = "u2"
+	set.Set["plan"] = "premium"
+	unset.Unset[0] = "plan"
+
+	profiles := rec.Profiles()
+	if len(profiles) != 2 {
+		t.Fatalf("unexpected profiles: %+v", profiles)
+	}
+
+	if recorded, ok := profiles[0].(*profile.Set); !ok || recorded.DistinctID != "u1" || recorded.Set["plan"] != "free" {
+		t.Fatalf("recorded action is changed: %+v", recorded)
+	}
+
+	if recorded, ok := profiles[1].(*profile.Unset); !ok || recorded.Unset[0] != "trial" {
+		t.Fatalf("recorded action is changed: %+v", recorded)
+	}
+}
+
+type TBMock struct {
+	errors []string
+}
+
+func (*TBMock) Helper() {}
+
+func (m *TBMock) Errorf(format string, args ...interface{}) {
+	m.errors = append(m.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertEvents(t *testing.T) {
+	expected := []*event.Data{
+		{Event: "login", Properties: event.Properties{
+			DistinctID:       "u1",
+			CustomProperties: event.CustomProperties{"attempt": 1},
+		}},
+	}
+	actual := []*event.Data{
+		{Event: "login", Properties: event.Properties{
+			InsertID:         "random",
+			DistinctID:       "u1",
+			Time:             time.Now(),
+			CustomProperties: event.CustomProperties{"attempt": 1.0},
+		}},
+	}
+
+	ingestiontest.AssertEvents(t, expected, actual)
+
+	actual[0].Properties.CustomProperties["attempt"] = 2
+	actual[0].Properties.CustomProperties["extra"] = true
+	mock := &TBMock{}
+	ingestiontest.AssertEvents(mock, expected, actual)
+
+	if len(mock.errors) != 1 {
+		t.Fatalf("expected assertion error")
+	}
+
+	for _, line := range []string{
+		"[#0] properties.attempt: expected 1, actual 2",
+		"[#0] properties.extra: unexpected true",
+	} {
+		if !strings.Contains(mock.errors[0], line) {
+			t.Fatalf("diff does not contain %q: %s", line, mock.errors[0])
+		}
+	}
+
+	if diff := ingestiontest.DiffEvent(expected[0], actual[0], "attempt", "extra"); diff != "" {
+		t.Fatalf("ignored properties are compared: %s", diff)
+	}
+}
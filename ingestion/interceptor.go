@@ -0,0 +1,242 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+// EventInterceptor is called for every event before encoding.
+// Interceptor may modify the event in place or return another one.
+// Returning nil event drops it silently, returning error aborts the client call.
+type EventInterceptor func(context.Context, *event.Data) (*event.Data, error)
+
+// ProfileInterceptor is called for every profile action before encoding.
+// Interceptor may modify the action in place or return another one.
+// Returning nil action drops it silently, returning error aborts the client call.
+type ProfileInterceptor func(context.Context, profile.Mutator) (profile.Mutator, error)
+
+// RequestInterceptor wraps execution of HTTP request.
+// Interceptor must call next to pass the request further or may return its own response.
+type RequestInterceptor func(req *http.Request, next HTTPDoer) (*http.Response, error)
+
+// doerFunc is adapter to use ordinary func as HTTPDoer.
+type doerFunc func(*http.Request) (*http.Response, error)
+
+func (f doerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithEventInterceptor registers event-level interceptors.
+// Interceptors are called in order of registration.
+func WithEventInterceptor(interceptors ...EventInterceptor) ClientOption {
+	return func(c *client) error {
+		for i, interceptor := range interceptors {
+			if interceptor == nil {
+				return fmt.Errorf("event interceptor #%d is nil", i)
+			}
+		}
+
+		c.interceptors.event = append(c.interceptors.event, interceptors...)
+
+		return nil
+	}
+}
+
+// WithProfileInterceptor registers profile-level interceptors.
+// Interceptors are called in order of registration.
+func WithProfileInterceptor(interceptors ...ProfileInterceptor) ClientOption {
+	return func(c *client) error {
+		for i, interceptor := range interceptors {
+			if interceptor == nil {
+				return fmt.Errorf("profile interceptor #%d is nil", i)
+			}
+		}
+
+		c.interceptors.profile = append(c.interceptors.profile, interceptors...)
+
+		return nil
+	}
+}
+
+// WithRequestInterceptor registers request-level interceptors.
+// First registered interceptor is the outermost one, it sees the request first and the response last.
+func WithRequestInterceptor(interceptors ...RequestInterceptor) ClientOption {
+	return func(c *client) error {
+		for i, interceptor := range interceptors {
+			if interceptor == nil {
+				return fmt.Errorf("request interceptor #%d is nil", i)
+			}
+		}
+
+		c.interceptors.request = append(c.interceptors.request, interceptors...)
+
+		return nil
+	}
+}
+
+// interceptEvent merges super properties and values carried by ctx into event,
+// passes it through registered interceptors and finishes its timer, returns nil if event was dropped.
+// Resubmitted dead letters are only checked for consent, they were prepared before the first attempt.
+func (c *client) interceptEvent(ctx context.Context, data *event.Data) (*event.Data, error) {
+	if data == nil {
+		return nil, fmt.Errorf("event object is nil")
+	}
+
+	if resubmitted(ctx) {
+		return c.consentResubmitted(ctx, data)
+	}
+
+	data, err := c.prepareEvent(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, interceptor := range c.interceptors.event {
+		if data == nil {
+			break
+		}
+
+		if data, err = interceptor(ctx, data); err != nil {
+			return nil, fmt.Errorf("event interceptor: %w", err)
+		}
+	}
+
+	// events dropped by interceptors, e.g. by sampling, keep their timers running
+	if data != nil && c.timers != nil {
+		data = c.timers.Finish(data)
+	}
+
+	return data, nil
+}
+
+// prepareEvent adds super properties, values carried by ctx and project token to event,
+// returns nil if event of opted-out user was dropped.
+func (c *client) prepareEvent(ctx context.Context, data *event.Data) (*event.Data, error) {
+	if c.super == nil {
+		data = withContext(ctx, data)
+	} else {
+		data = mergeEvent(data, DistinctIDFromContext(ctx), c.super.Properties(ctx), PropertiesFromContext(ctx))
+	}
+
+	if c.consent != nil {
+		allowed, err := c.consentEvent(ctx, data)
+		if allowed == nil || err != nil {
+			return nil, err
+		}
+
+		data = allowed
+	}
+
+	if c.token == "" {
+		return data, nil
+	}
+
+	return c.injectEventToken(data)
+}
+
+// preparesEvents reports whether events are changed before encoding.
+func (c *client) preparesEvents(ctx context.Context) bool {
+	return len(c.interceptors.event) > 0 || c.super != nil || c.timers != nil || c.token != "" || c.consent != nil ||
+		DistinctIDFromContext(ctx) != "" || len(PropertiesFromContext(ctx)) > 0
+}
+
+// interceptEvents passes every batch item through interceptEvent, dropped events are excluded.
+func (c *client) interceptEvents(ctx context.Context, batch []*event.Data) ([]*event.Data, error) {
+	if !c.preparesEvents(ctx) {
+		return batch, nil
+	}
+
+	result := make([]*event.Data, 0, len(batch))
+
+	for _, data := range batch {
+		data, err := c.interceptEvent(ctx, data)
+		if err != nil {
+			return nil, err
+		}
+
+		if data != nil {
+			result = append(result, data)
+		}
+	}
+
+	return result, nil
+}
+
+// interceptProfile checks consent of the user, sets project token of action
+// and passes it through registered interceptors, returns nil if action was dropped.
+// Resubmitted dead letters are only checked for consent, they were prepared before the first attempt.
+func (c *client) interceptProfile(ctx context.Context, action profile.Mutator) (profile.Mutator, error) {
+	if action == nil {
+		return nil, fmt.Errorf("engage action is nil")
+	}
+
+	var err error
+
+	if c.consent != nil {
+		if action, err = c.consentProfile(ctx, action); action == nil || err != nil {
+			return nil, err
+		}
+	}
+
+	if resubmitted(ctx) {
+		return action, nil
+	}
+
+	if c.token != "" {
+		if action, err = c.injectProfileToken(action); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, interceptor := range c.interceptors.profile {
+		if action == nil {
+			break
+		}
+
+		if action, err = interceptor(ctx, action); err != nil {
+			return nil, fmt.Errorf("profile interceptor: %w", err)
+		}
+	}
+
+	return action, nil
+}
+
+// interceptProfiles passes every batch item through registered interceptors, dropped actions are excluded.
+func (c *client) interceptProfiles(ctx context.Context, batch []profile.Mutator) ([]profile.Mutator, error) {
+	if len(c.interceptors.profile) == 0 && c.token == "" && c.consent == nil {
+		return batch, nil
+	}
+
+	result := make([]profile.Mutator, 0, len(batch))
+
+	for _, action := range batch {
+		action, err := c.interceptProfile(ctx, action)
+		if err != nil {
+			return nil, err
+		}
+
+		if action != nil {
+			result = append(result, action)
+		}
+	}
+
+	return result, nil
+}
+
+// do executes HTTP request through registered request interceptors.
+func (c *client) do(req *http.Request) (*http.Response, error) {
+	doer := c.dump(c.httpc)
+
+	for i := len(c.interceptors.request) - 1; i >= 0; i-- {
+		interceptor, next := c.interceptors.request[i], doer
+		doer = doerFunc(func(req *http.Request) (*http.Response, error) {
+			return interceptor(req, next)
+		})
+	}
+
+	return doer.Do(req)
+}
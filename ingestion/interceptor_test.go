@@ -0,0 +1,133 @@
+package ingestion_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+func Test_Client_interceptors(t *testing.T) {
+	var (
+		order []string
+		sent  []*http.Request
+	)
+
+	doer := HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+		order = append(order, "doer")
+		sent = append(sent, req)
+
+		return ResponseStatus(http.StatusOK, req), nil
+	})
+
+	request := func(name string) ingestion.RequestInterceptor {
+		return func(req *http.Request, next ingestion.HTTPDoer) (*http.Response, error) {
+			order = append(order, name+":before")
+			req.Header.Add("X-Interceptor", name)
+			resp, err := next.Do(req)
+			order = append(order, name+":after")
+
+			return resp, err
+		}
+	}
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(doer),
+		ingestion.WithEventInterceptor(
+			func(_ context.Context, data *event.Data) (*event.Data, error) {
+				order = append(order, "event:1")
+				data.Properties.Token = "intercepted"
+
+				return data, nil
+			},
+			func(_ context.Context, data *event.Data) (*event.Data, error) {
+				order = append(order, "event:2")
+				if data.Event == "drop" {
+					return nil, nil
+				}
+
+				return data, nil
+			},
+		),
+		ingestion.WithRequestInterceptor(request("outer"), request("inner")),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Track(context.Background(), &event.Data{Event: "test"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "event:1,event:2,outer:before,inner:before,doer,inner:after,outer:after"
+	if actual := strings.Join(order, ","); actual != expected {
+		t.Fatalf("expected order %q, actual %q", expected, actual)
+	}
+
+	if actual := sent[0].Header.Values("X-Interceptor"); strings.Join(actual, ",") != "outer,inner" {
+		t.Fatalf("unexpected request headers: %v", actual)
+	}
+
+	if err := sent[0].ParseForm(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := event.Data{}
+	if err := json.Unmarshal([]byte(sent[0].PostForm.Get("data")), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	if data.Properties.Token != "intercepted" {
+		t.Fatalf("event modification lost: %+v", data)
+	}
+
+	if err := cli.Track(context.Background(), &event.Data{Event: "drop"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.TrackBatch(context.Background(), []*event.Data{{Event: "drop"}, {Event: "drop"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sent) != 1 {
+		t.Fatalf("dropped events were sent, requests: %d", len(sent))
+	}
+}
+
+func Test_Client_profile_interceptor_error(t *testing.T) {
+	failure := errors.New("tenant is unknown")
+	doer := HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+		t.Fatal("request must not be sent")
+
+		return nil, nil
+	})
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(doer),
+		ingestion.WithProfileInterceptor(func(context.Context, profile.Mutator) (profile.Mutator, error) {
+			return nil, failure
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.Engage(context.Background(), &profile.Set{Set: map[string]interface{}{"k": "v"}})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected interceptor error, actual: %v", err)
+	}
+
+	err = cli.EngageBatch(context.Background(), []profile.Mutator{&profile.Unset{Unset: []string{"k"}}})
+	if !errors.Is(err, failure) {
+		t.Fatalf("expected interceptor error, actual: %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package ingestion
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/wtask-go/mixpanel/internal/redact"
+)
+
+// Logger is structured logger used by the client.
+// Key-value pairs follow the message, like in go-kit, logr or zap sugared logger.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// Redacted replaces sensitive values in debug dumps.
+const Redacted = redact.Placeholder
+
+// DefaultDumpLimit is the default limit of request and response body size in debug dumps.
+const DefaultDumpLimit = 4096
+
+// WithLogger sets logger to report failed requests.
+func WithLogger(logger Logger) ClientOption {
+	return func(c *client) error {
+		if logger == nil {
+			return fmt.Errorf("logger is nil")
+		}
+
+		c.logger = logger
+
+		return nil
+	}
+}
+
+// WithDebugDump enables debug logging of decoded request payloads and response bodies.
+// Project tokens and API secrets are redacted, dumped bodies are truncated to the limit in bytes,
+// zero or negative limit means DefaultDumpLimit. Has no effect without logger, see WithLogger.
+func WithDebugDump(limit int) ClientOption {
+	return func(c *client) error {
+		if limit <= 0 {
+			limit = DefaultDumpLimit
+		}
+
+		c.dumpLimit = limit
+
+		return nil
+	}
+}
+
+func (c *client) logFailure(req *http.Request, items int, err error) {
+	if c.logger == nil || err == nil {
+		return
+	}
+
+	c.logger.Error("mixpanel request failed", "endpoint", endpointName(req.URL), "items", items, "error", err)
+}
+
+// dump wraps HTTP doer to log requests and responses passed through.
+func (c *client) dump(doer HTTPDoer) HTTPDoer {
+	if c.logger == nil || c.dumpLimit <= 0 {
+		return doer
+	}
+
+	return doerFunc(func(req *http.Request) (*http.Response, error) {
+		c.logger.Debug(
+			"mixpanel request",
+			"method", req.Method,
+			"url", redactURL(req.URL),
+			"payload", c.dumpRequestBody(req),
+		)
+
+		resp, err := doer.Do(req)
+		if err != nil {
+			c.logger.Debug("mixpanel response", "url", redactURL(req.URL), "error", err)
+
+			return resp, err
+		}
+
+		c.logger.Debug(
+			"mixpanel response",
+			"url", redactURL(req.URL),
+			"status", resp.StatusCode,
+			"content_type", resp.Header.Get("Content-Type"),
+			"body", c.dumpResponseBody(resp),
+		)
+
+		return resp, err
+	})
+}
+
+// dumpRequestBody decodes url-encoded form with redacted `data` JSON.
+// Request body is not consumed, a copy is got from req.GetBody.
+func (c *client) dumpRequestBody(req *http.Request) string {
+	if req.GetBody == nil {
+		return ""
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return fmt.Sprintf("(get body: %s)", err)
+	}
+
+	defer func() {
+		_ = body.Close()
+	}()
+
+	raw, err := ioutil.ReadAll(body)
+	if err != nil {
+		return fmt.Sprintf("(read body: %s)", err)
+	}
+
+	values, err := url.ParseQuery(string(raw))
+	if err != nil {
+		return truncate(string(raw), c.dumpLimit)
+	}
+
+	payload := map[string]interface{}{}
+
+	for name := range values {
+		value := values.Get(name)
+
+		switch {
+		case redact.IsSensitive(name):
+			payload[name] = Redacted
+		case name == "data":
+			var data interface{}
+			if err := json.Unmarshal([]byte(value), &data); err != nil {
+				payload[name] = value
+
+				continue
+			}
+
+			payload[name] = redact.JSON(data)
+		default:
+			payload[name] = value
+		}
+	}
+
+	dump, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Sprintf("(marshal payload: %s)", err)
+	}
+
+	return truncate(string(dump), c.dumpLimit)
+}
+
+// dumpResponseBody reads response body and replaces it with a copy.
+func (c *client) dumpResponseBody(resp *http.Response) string {
+	if resp.Body == nil {
+		return ""
+	}
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(raw))
+
+	if err != nil {
+		return fmt.Sprintf("(read body: %s)", err)
+	}
+
+	return truncate(string(raw), c.dumpLimit)
+}
+
+// redactURL returns URL string with redacted sensitive query parameters and without user info.
+func redactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+
+	redacted := *u
+	redacted.User = nil
+
+	query := redacted.Query()
+	for key := range query {
+		if redact.IsSensitive(key) {
+			query.Set(key, Redacted)
+		}
+	}
+
+	redacted.RawQuery = query.Encode()
+
+	return redacted.String()
+}
+
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+
+	return strings.ToValidUTF8(s[:limit], "") + fmt.Sprintf("...(%d bytes truncated)", len(s)-limit)
+}
@@ -0,0 +1,107 @@
+package ingestion_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+type LoggerMock struct {
+	lines []string
+}
+
+func (l *LoggerMock) log(level, msg string, keyvals ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprint(level, " ", msg, " ", keyvals))
+}
+
+func (l *LoggerMock) Debug(msg string, keyvals ...interface{}) {
+	l.log("DEBUG", msg, keyvals...)
+}
+
+func (l *LoggerMock) Error(msg string, keyvals ...interface{}) {
+	l.log("ERROR", msg, keyvals...)
+}
+
+func Test_Client_debug_dump(t *testing.T) {
+	logger := &LoggerMock{}
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+			return ResponseStatus(http.StatusOK, req), nil
+		})),
+		ingestion.WithLogger(logger),
+		ingestion.WithDebugDump(0),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.Track(context.Background(), &event.Data{
+		Event: "signed-up",
+		Properties: event.Properties{
+			Token:            "secret-project-token",
+			CustomProperties: event.CustomProperties{"plan": "premium"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.Engage(context.Background(), &profile.Set{
+		Token: "secret-project-token",
+		Set:   map[string]interface{}{"plan": "premium"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump := strings.Join(logger.lines, "\n")
+	if strings.Contains(dump, "secret-project-token") {
+		t.Fatalf("token is not redacted: %s", dump)
+	}
+
+	for _, expected := range []string{"signed-up", "premium", ingestion.Redacted, `{"status":1}`} {
+		if !strings.Contains(dump, expected) {
+			t.Fatalf("dump does not contain %q: %s", expected, dump)
+		}
+	}
+}
+
+func Test_Client_debug_dump_limit(t *testing.T) {
+	logger := &LoggerMock{}
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+			return ResponseStatus(http.StatusInternalServerError, req), nil
+		})),
+		ingestion.WithLogger(logger),
+		ingestion.WithDebugDump(16),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = cli.Track(context.Background(), &event.Data{
+		Event: strings.Repeat("x", 100),
+	})
+
+	if len(logger.lines) != 3 {
+		t.Fatalf("expected request, response and error lines, actual: %v", logger.lines)
+	}
+
+	if strings.Contains(logger.lines[0], strings.Repeat("x", 17)) || !strings.Contains(logger.lines[0], "truncated") {
+		t.Fatalf("payload is not truncated: %s", logger.lines[0])
+	}
+
+	if !strings.HasPrefix(logger.lines[2], "ERROR") {
+		t.Fatalf("failure is not logged: %s", logger.lines[2])
+	}
+}
@@ -0,0 +1,204 @@
+package ingestion
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"net/url"
+	"path"
+	"sync"
+	"time"
+)
+
+// MetricsObserver receives delivery metrics from the client.
+// Implementation must be safe for concurrent use and must not block.
+type MetricsObserver interface {
+	// ObserveRequest is called when client call is completed, successfully or not.
+	ObserveRequest(RequestMetrics)
+	// ObserveDropped is called when items were dropped without sending, e.g. by interceptors.
+	ObserveDropped(endpoint string, items int)
+	// ObserveQueueDepth is called by buffering layers to report number of items waiting for delivery.
+	ObserveQueueDepth(queue string, depth int)
+}
+
+// RequestMetrics describes single request to Mixpanel.
+type RequestMetrics struct {
+	// Endpoint is path and fragment of operation, for example "track#live-event".
+	Endpoint string
+	// Items is the number of events or profile actions in the request.
+	Items int
+	// Attempt is the number of delivery attempt of items, it is greater than 1 when dead letter is resubmitted.
+	Attempt int
+	// PayloadSize is size of request body in bytes.
+	PayloadSize int64
+	// Latency is the time spent to send request and to parse response.
+	Latency time.Duration
+	// Err is the result of request. Request was not sent when Err is ErrCircuitOpen.
+	Err error
+}
+
+// Outcome returns low-cardinality label of request result: "ok", "rejected" or "failed".
+func (m *RequestMetrics) Outcome() string {
+	switch {
+	case m.Err == nil:
+		return "ok"
+	case errors.Is(m.Err, ErrCircuitOpen):
+		return "rejected"
+	}
+
+	return "failed"
+}
+
+// MetricsObserverFuncs is adapter to build MetricsObserver from funcs,
+// for example to bridge the client metrics with Prometheus collectors. Nil funcs are skipped.
+type MetricsObserverFuncs struct {
+	Request    func(RequestMetrics)
+	Dropped    func(endpoint string, items int)
+	QueueDepth func(queue string, depth int)
+}
+
+// ObserveRequest implements MetricsObserver interface.
+func (f MetricsObserverFuncs) ObserveRequest(m RequestMetrics) {
+	if f.Request != nil {
+		f.Request(m)
+	}
+}
+
+// ObserveDropped implements MetricsObserver interface.
+func (f MetricsObserverFuncs) ObserveDropped(endpoint string, items int) {
+	if f.Dropped != nil {
+		f.Dropped(endpoint, items)
+	}
+}
+
+// ObserveQueueDepth implements MetricsObserver interface.
+func (f MetricsObserverFuncs) ObserveQueueDepth(queue string, depth int) {
+	if f.QueueDepth != nil {
+		f.QueueDepth(queue, depth)
+	}
+}
+
+// WithMetricsObserver sets observer to collect delivery metrics.
+func WithMetricsObserver(observer MetricsObserver) ClientOption {
+	return func(c *client) error {
+		if observer == nil {
+			return fmt.Errorf("metrics observer is nil")
+		}
+
+		c.metrics = observer
+
+		return nil
+	}
+}
+
+func (c *client) observeRequest(endpoint *url.URL, items, attempt int, size int64, latency time.Duration, err error) {
+	if c.metrics == nil {
+		return
+	}
+
+	c.metrics.ObserveRequest(RequestMetrics{
+		Endpoint:    endpointName(endpoint),
+		Items:       items,
+		Attempt:     attempt,
+		PayloadSize: size,
+		Latency:     latency,
+		Err:         err,
+	})
+}
+
+func (c *client) observeDropped(endpoint *url.URL, items int) {
+	if c.metrics == nil || items <= 0 {
+		return
+	}
+
+	c.metrics.ObserveDropped(endpointName(endpoint), items)
+}
+
+// endpointName builds metrics label from endpoint URL.
+// Path prefix of server URL is omitted, so names do not depend on the server.
+func endpointName(endpoint *url.URL) string {
+	name := path.Base(endpoint.Path)
+	if endpoint.Fragment != "" {
+		name += "#" + endpoint.Fragment
+	}
+
+	return name
+}
+
+// ExpvarMetrics is MetricsObserver which publishes metrics with expvar package.
+// Published map contains "endpoints" map of counters per endpoint and "queues" map of queue depths.
+// Counters of endpoint are "requests", "failures", "rejected" by circuit breaker, "payload_bytes", "latency_seconds"
+// and "items_sent", "items_failed", "items_retried" and "items_dropped". Items are retried by Resubmit,
+// the client itself does not retry requests.
+type ExpvarMetrics struct {
+	mu        sync.Mutex
+	endpoints *expvar.Map
+	queues    *expvar.Map
+}
+
+// NewExpvarMetrics builds and publishes metrics under specified name.
+// Like expvar.Publish, it panics if the name is already registered,
+// so calling it twice with the same name panics: build metrics once and share them between clients.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	m := &ExpvarMetrics{
+		endpoints: new(expvar.Map).Init(),
+		queues:    new(expvar.Map).Init(),
+	}
+	root := expvar.NewMap(name)
+	root.Set("endpoints", m.endpoints)
+	root.Set("queues", m.queues)
+
+	return m
+}
+
+func (m *ExpvarMetrics) endpoint(name string) *expvar.Map {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if v, ok := m.endpoints.Get(name).(*expvar.Map); ok {
+		return v
+	}
+
+	v := new(expvar.Map).Init()
+	m.endpoints.Set(name, v)
+
+	return v
+}
+
+// ObserveRequest implements MetricsObserver interface.
+func (m *ExpvarMetrics) ObserveRequest(r RequestMetrics) {
+	counters := m.endpoint(r.Endpoint)
+
+	if r.Attempt > 1 {
+		counters.Add("items_retried", int64(r.Items))
+	}
+
+	switch r.Outcome() {
+	case "rejected":
+		counters.Add("rejected", 1)
+		counters.Add("items_failed", int64(r.Items))
+
+		return
+	case "ok":
+		counters.Add("items_sent", int64(r.Items))
+	default:
+		counters.Add("failures", 1)
+		counters.Add("items_failed", int64(r.Items))
+	}
+
+	counters.Add("requests", 1)
+	counters.Add("payload_bytes", r.PayloadSize)
+	counters.AddFloat("latency_seconds", r.Latency.Seconds())
+}
+
+// ObserveDropped implements MetricsObserver interface.
+func (m *ExpvarMetrics) ObserveDropped(endpoint string, items int) {
+	m.endpoint(endpoint).Add("items_dropped", int64(items))
+}
+
+// ObserveQueueDepth implements MetricsObserver interface.
+func (m *ExpvarMetrics) ObserveQueueDepth(queue string, depth int) {
+	v := new(expvar.Int)
+	v.Set(int64(depth))
+	m.queues.Set(queue, v)
+}
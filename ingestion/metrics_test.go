@@ -0,0 +1,112 @@
+package ingestion_test
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+func Test_Client_metrics_observer(t *testing.T) {
+	var (
+		requests []ingestion.RequestMetrics
+		dropped  = map[string]int{}
+	)
+
+	observer := ingestion.MetricsObserverFuncs{
+		Request: func(m ingestion.RequestMetrics) {
+			requests = append(requests, m)
+		},
+		Dropped: func(endpoint string, items int) {
+			dropped[endpoint] += items
+		},
+	}
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+			return ResponseStatus(http.StatusOK, req), nil
+		})),
+		ingestion.WithEventInterceptor(func(_ context.Context, data *event.Data) (*event.Data, error) {
+			if data.Event == "drop" {
+				return nil, nil
+			}
+
+			return data, nil
+		}),
+		ingestion.WithMetricsObserver(observer),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.TrackBatch(context.Background(), []*event.Data{{Event: "a"}, {Event: "drop"}, {Event: "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 observed request, actual %d", len(requests))
+	}
+
+	m := requests[0]
+	if m.Endpoint != "track#past-events-batch" || m.Items != 2 || m.Attempt != 1 || m.PayloadSize <= 0 ||
+		m.Outcome() != "ok" {
+		t.Fatalf("unexpected request metrics: %+v", m)
+	}
+
+	if dropped["track#past-events-batch"] != 1 {
+		t.Fatalf("unexpected dropped metrics: %v", dropped)
+	}
+}
+
+// expvarRuns makes published names unique, as expvar does not allow to publish the same name twice.
+var expvarRuns int
+
+func Test_ExpvarMetrics(t *testing.T) {
+	expvarRuns++
+	name := fmt.Sprintf("%s_%d", t.Name(), expvarRuns)
+	metrics := ingestion.NewExpvarMetrics(name)
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+			return ResponseStatus(http.StatusBadGateway, req), nil
+		})),
+		ingestion.WithMetricsObserver(metrics),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_ = cli.Track(context.Background(), &event.Data{Event: "test"})
+	_ = ingestion.Resubmit(context.Background(), cli, &ingestion.DeadLetter{
+		Endpoint: "track#live-event",
+		Events:   []*event.Data{{Event: "test"}},
+		Attempts: 1,
+	})
+	metrics.ObserveQueueDepth("async", 7)
+
+	published := struct {
+		Endpoints map[string]map[string]float64 `json:"endpoints"`
+		Queues    map[string]int                `json:"queues"`
+	}{}
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil {
+		t.Fatal(err)
+	}
+
+	counters := published.Endpoints["track#live-event"]
+	if counters["requests"] != 2 || counters["failures"] != 2 || counters["items_failed"] != 2 ||
+		counters["items_retried"] != 1 {
+		t.Fatalf("unexpected counters: %v", counters)
+	}
+
+	if published.Queues["async"] != 7 {
+		t.Fatalf("unexpected queues: %v", published.Queues)
+	}
+}
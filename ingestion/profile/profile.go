@@ -2,6 +2,11 @@
 // provided by Mixpanel Ingestion API.
 package profile
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 // Set describes model of request to set values of user profile properties.
 // If the profile does not exist, it creates it with these properties.
 // If it does exist, it sets the properties to these values, overwriting existing values.
@@ -49,6 +54,16 @@ type Unset struct {
 	Unset      []string `json:"$unset"`
 }
 
+// Delete describes model of request to permanently delete user profile with all of its properties.
+// Value of `$delete` is ignored by Mixpanel. Set IgnoreAlias to delete duplicate profile
+// without deleting the original one, when alias is used as distinct ID.
+type Delete struct {
+	Token       string `json:"$token"`
+	DistinctID  string `json:"$distinct_id"`
+	Delete      string `json:"$delete"`
+	IgnoreAlias bool   `json:"$ignore_alias,omitempty"`
+}
+
 // Mutator is internal interface to mark models as profile mutation actions.
 type Mutator interface {
 	isMutator()
@@ -60,3 +75,77 @@ func (x NumberAdd) isMutator()  {}
 func (x ListAppend) isMutator() {}
 func (x ListRemove) isMutator() {}
 func (x Unset) isMutator()      {}
+func (x Delete) isMutator()     {}
+
+// DistinctID returns distinct ID of profile action or empty string for unknown action.
+func DistinctID(action Mutator) string {
+	switch a := action.(type) {
+	case *Set:
+		return a.DistinctID
+	case *SetOnce:
+		return a.DistinctID
+	case *NumberAdd:
+		return a.DistinctID
+	case *ListAppend:
+		return a.DistinctID
+	case *ListRemove:
+		return a.DistinctID
+	case *Unset:
+		return a.DistinctID
+	case *Delete:
+		return a.DistinctID
+	}
+
+	return ""
+}
+
+// UnmarshalMutator decodes JSON object of profile action,
+// type of action is detected by operation key
+// (`$set`, `$set_once`, `$add`, `$append`, `$remove`, `$unset`, `$delete`).
+func UnmarshalMutator(data []byte) (Mutator, error) {
+	keys := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+
+	var action Mutator
+
+	for key := range keys {
+		var candidate Mutator
+
+		switch key {
+		default:
+			continue
+		case "$set":
+			candidate = &Set{}
+		case "$set_once":
+			candidate = &SetOnce{}
+		case "$add":
+			candidate = &NumberAdd{}
+		case "$append":
+			candidate = &ListAppend{}
+		case "$remove":
+			candidate = &ListRemove{}
+		case "$unset":
+			candidate = &Unset{}
+		case "$delete":
+			candidate = &Delete{}
+		}
+
+		if action != nil {
+			return nil, fmt.Errorf("ambiguous profile action")
+		}
+
+		action = candidate
+	}
+
+	if action == nil {
+		return nil, fmt.Errorf("unknown profile action")
+	}
+
+	if err := json.Unmarshal(data, action); err != nil {
+		return nil, err
+	}
+
+	return action, nil
+}
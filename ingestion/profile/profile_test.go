@@ -2,6 +2,7 @@ package profile_test
 
 import (
 	"encoding/json"
+	"reflect"
 	"testing"
 
 	"github.com/wtask-go/mixpanel/ingestion/profile"
@@ -61,6 +62,9 @@ func Test_json_schema(t *testing.T) {
 				"numeric_key",
 			}}, true,
 		},
+		{
+			&profile.Delete{IgnoreAlias: true}, true,
+		},
 	}
 
 	schema := assets.MustCompileSchema("openapi/engage.schema.json")
@@ -81,3 +85,55 @@ func Test_json_schema(t *testing.T) {
 		}
 	}
 }
+
+func TestUnmarshalMutator(t *testing.T) {
+	cases := []struct {
+		data     string
+		expected profile.Mutator
+	}{
+		{
+			`{"$token":"t","$distinct_id":"u","$set":{"k":"v"}}`,
+			&profile.Set{Token: "t", DistinctID: "u", Set: map[string]interface{}{"k": "v"}},
+		},
+		{
+			`{"$token":"t","$distinct_id":"u","$set_once":{"k":"v"}}`,
+			&profile.SetOnce{Token: "t", DistinctID: "u", SetOnce: map[string]interface{}{"k": "v"}},
+		},
+		{
+			`{"$token":"t","$distinct_id":"u","$add":{"k":1}}`,
+			&profile.NumberAdd{Token: "t", DistinctID: "u", Add: map[string]interface{}{"k": 1.0}},
+		},
+		{
+			`{"$token":"t","$distinct_id":"u","$append":{"k":"v"}}`,
+			&profile.ListAppend{Token: "t", DistinctID: "u", Append: map[string]interface{}{"k": "v"}},
+		},
+		{
+			`{"$token":"t","$distinct_id":"u","$remove":{"k":"v"}}`,
+			&profile.ListRemove{Token: "t", DistinctID: "u", Remove: map[string]interface{}{"k": "v"}},
+		},
+		{
+			`{"$token":"t","$distinct_id":"u","$unset":["k"]}`,
+			&profile.Unset{Token: "t", DistinctID: "u", Unset: []string{"k"}},
+		},
+		{
+			`{"$token":"t","$distinct_id":"u","$delete":""}`,
+			&profile.Delete{Token: "t", DistinctID: "u"},
+		},
+		{`{"$token":"t","$distinct_id":"u"}`, nil},
+		{`{"$token":"t","$distinct_id":"u","$set":{"k":"v"},"$unset":["k"]}`, nil},
+		{`[]`, nil},
+	}
+
+	for i, c := range cases {
+		action, err := profile.UnmarshalMutator([]byte(c.data))
+
+		switch {
+		case err != nil && c.expected != nil:
+			t.Fatalf("[#%d] unexpected error: %s", i, err)
+		case err == nil && c.expected == nil:
+			t.Fatalf("[#%d] expected error, actual: %+v", i, action)
+		case !reflect.DeepEqual(action, c.expected) && c.expected != nil:
+			t.Fatalf("[#%d] expected: %+v, actual: %+v", i, c.expected, action)
+		}
+	}
+}
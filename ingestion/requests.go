@@ -52,38 +52,46 @@ func (c *client) makeTrackBatchRequest(batch []*event.Data) (*http.Request, erro
 }
 
 func (c *client) makeEngageRequest(action profile.Mutator) (*http.Request, error) {
-	var url string
+	endpoint, err := c.engageEndpoint(action)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(action)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := form.NewValues(data, form.WithVerboseResponse(true))
+	if err != nil {
+		return nil, err
+	}
 
+	return makeFormURLEncodedPost(endpoint.String(), body)
+}
+
+// engageEndpoint selects endpoint by type of profile action.
+func (c *client) engageEndpoint(action profile.Mutator) (*url.URL, error) {
 	switch action.(type) {
 	default:
 		return nil, fmt.Errorf("unsupported engage action type %T", action)
 	case nil:
 		return nil, fmt.Errorf("engage action is nil")
 	case *profile.Set:
-		url = c.endpoint.engage.set.String()
+		return c.endpoint.engage.set, nil
 	case *profile.SetOnce:
-		url = c.endpoint.engage.setOnce.String()
+		return c.endpoint.engage.setOnce, nil
 	case *profile.NumberAdd:
-		url = c.endpoint.engage.add.String()
+		return c.endpoint.engage.add, nil
 	case *profile.ListAppend:
-		url = c.endpoint.engage.append.String()
+		return c.endpoint.engage.append, nil
 	case *profile.ListRemove:
-		url = c.endpoint.engage.remove.String()
+		return c.endpoint.engage.remove, nil
 	case *profile.Unset:
-		url = c.endpoint.engage.unset.String()
-	}
-
-	data, err := json.Marshal(action)
-	if err != nil {
-		return nil, err
+		return c.endpoint.engage.unset, nil
+	case *profile.Delete:
+		return c.endpoint.engage.delete, nil
 	}
-
-	body, err := form.NewValues(data, form.WithVerboseResponse(true))
-	if err != nil {
-		return nil, err
-	}
-
-	return makeFormURLEncodedPost(url, body)
 }
 
 func (c *client) makeEngageBatchRequest(batch []profile.Mutator) (*http.Request, error) {
@@ -2,43 +2,32 @@ package ingestion_test
 
 import (
 	"context"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
-	"github.com/getkin/kin-openapi/openapi3"
-	"github.com/getkin/kin-openapi/openapi3filter"
-	"github.com/getkin/kin-openapi/routers/legacy"
 	"github.com/wtask-go/mixpanel/ingestion"
 	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
 	"github.com/wtask-go/mixpanel/ingestion/profile"
-	"github.com/wtask-go/mixpanel/internal/assets"
 )
 
-func init() {
-	// this formats are not automatically registered
-	openapi3.DefineIPv4Format()
-	openapi3.DefineIPv6Format()
-}
-
 func Test_Client_openapi_requests(t *testing.T) {
-	openapi3filter.RegisterBodyDecoder("application/x-www-form-urlencoded", urlencodedBodyDecoder)
-
-	router, err := legacy.NewRouter(
-		assets.MustCompileIngestionSpecification(),
-	)
+	validator, err := ingestiontest.NewOpenAPIValidator(nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	cli, err := ingestion.NewClient(
 		"https://api-eu.mixpanel.com",
-		ingestion.WithHTTPDoer(OpenAPIRequestValidator(t, router)),
+		ingestion.WithHTTPDoer(validator),
 	)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_ = cli.Track(context.Background(), &event.Data{
+	err = cli.Track(context.Background(), &event.Data{
 		Event: "live-1",
 		Properties: event.Properties{
 			InsertID:   "uuid",
@@ -51,8 +40,11 @@ func Test_Client_openapi_requests(t *testing.T) {
 			},
 		},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	_ = cli.TrackDeduplicate(context.Background(), &event.Data{
+	err = cli.TrackDeduplicate(context.Background(), &event.Data{
 		Event: "deduplicate-1",
 		Properties: event.Properties{
 			InsertID:   "uuid",
@@ -65,8 +57,11 @@ func Test_Client_openapi_requests(t *testing.T) {
 			},
 		},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	_ = cli.TrackBatch(context.Background(), []*event.Data{
+	err = cli.TrackBatch(context.Background(), []*event.Data{
 		{
 			Event: "outdated-1",
 			Properties: event.Properties{
@@ -81,56 +76,85 @@ func Test_Client_openapi_requests(t *testing.T) {
 			},
 		},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	_ = cli.Engage(context.Background(), &profile.Set{
+	err = cli.Engage(context.Background(), &profile.Set{
 		Token:      "token",
 		DistinctID: "user-id",
 		Set: map[string]interface{}{
 			"counter": 0,
 		},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	_ = cli.Engage(context.Background(), &profile.SetOnce{
+	err = cli.Engage(context.Background(), &profile.SetOnce{
 		Token:      "token",
 		DistinctID: "user-id",
 		SetOnce: map[string]interface{}{
 			"verified": true,
 		},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	_ = cli.Engage(context.Background(), &profile.NumberAdd{
+	err = cli.Engage(context.Background(), &profile.NumberAdd{
 		Token:      "token",
 		DistinctID: "user-id",
 		Add: map[string]interface{}{
 			"counter": 1,
 		},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	_ = cli.Engage(context.Background(), &profile.ListAppend{
+	err = cli.Engage(context.Background(), &profile.ListAppend{
 		Token:      "token",
 		DistinctID: "user-id",
 		Append: map[string]interface{}{
 			"roles": "user",
 		},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	_ = cli.Engage(context.Background(), &profile.ListRemove{
+	err = cli.Engage(context.Background(), &profile.ListRemove{
 		Token:      "token",
 		DistinctID: "user-id",
 		Remove: map[string]interface{}{
 			"roles": "manager",
 		},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	_ = cli.Engage(context.Background(), &profile.Unset{
+	err = cli.Engage(context.Background(), &profile.Unset{
 		Token:      "token",
 		DistinctID: "user-id",
 		Unset: []string{
 			"counter",
 		},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	_ = cli.EngageBatch(context.Background(), []profile.Mutator{
+	err = cli.Engage(context.Background(), &profile.Delete{
+		Token:      "token",
+		DistinctID: "user-id",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.EngageBatch(context.Background(), []profile.Mutator{
 		&profile.Set{
 			Token:      "token",
 			DistinctID: "user-id",
@@ -174,4 +198,40 @@ func Test_Client_openapi_requests(t *testing.T) {
 			},
 		},
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_Client_server_path_prefix(t *testing.T) {
+	paths := []string{}
+
+	validator, err := ingestiontest.NewOpenAPIValidator(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+		paths = append(paths, req.URL.Path)
+		resp := ResponseOK(`{"status":1}`, req)
+		resp.Header.Set("Content-Type", "application/json")
+
+		return resp, nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cli, err := ingestion.NewClient("https://proxy.example.com/mp/", ingestion.WithHTTPDoer(validator))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cli.Track(context.Background(), &event.Data{Event: "e", Properties: event.Properties{Token: "t"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cli.Engage(context.Background(), &profile.Delete{Token: "t", DistinctID: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(paths, ",") != "/mp/track,/mp/engage" {
+		t.Fatalf("unexpected paths: %v", paths)
+	}
 }
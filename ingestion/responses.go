@@ -2,6 +2,7 @@ package ingestion
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -10,6 +11,31 @@ import (
 	"strings"
 )
 
+// ResponseError is returned when Mixpanel responds with failure status or unexpected response.
+type ResponseError struct {
+	StatusCode  int
+	Status      string
+	ContentType string
+	// Message is error details reported by Mixpanel, if any.
+	Message string
+}
+
+func (e *ResponseError) Error() string {
+	switch {
+	case e.Message != "":
+		return fmt.Sprintf("request failed: %s", e.Message)
+	case e.StatusCode == http.StatusOK:
+		return "request failed"
+	}
+
+	return fmt.Sprintf("unexpected response: %d %s, %s", e.StatusCode, e.Status, e.ContentType)
+}
+
+// Temporary returns true if request may succeed later, i.e. Mixpanel responded with 429 or 5xx status.
+func (e *ResponseError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
 func (*client) parseResponse(resp *http.Response) error {
 	if resp == nil {
 		return fmt.Errorf("HTTP response is nil")
@@ -22,7 +48,7 @@ func (*client) parseResponse(resp *http.Response) error {
 
 	switch {
 	default:
-		err = fmt.Errorf("unexpected response: %d %s, %s", resp.StatusCode, resp.Status, contentType)
+		err = &ResponseError{}
 	case resp.StatusCode == http.StatusOK && strings.Contains(contentType, "text/plain"):
 		err = parsePlainText200(resp.Body)
 	case resp.StatusCode == http.StatusOK && strings.Contains(contentType, "application/json"):
@@ -32,6 +58,11 @@ func (*client) parseResponse(resp *http.Response) error {
 		err = parseJSONError(resp.Body)
 	}
 
+	var respErr *ResponseError
+	if errors.As(err, &respErr) {
+		respErr.StatusCode, respErr.Status, respErr.ContentType = resp.StatusCode, resp.Status, contentType
+	}
+
 	return err
 }
 
@@ -52,7 +83,7 @@ func parsePlainText200(body io.ReadCloser) error {
 	}
 
 	if response == 0 {
-		return fmt.Errorf("request failed")
+		return &ResponseError{}
 	}
 
 	return nil
@@ -81,7 +112,7 @@ func parseJSON200(body io.ReadCloser) error {
 			response.Error = "details not provided"
 		}
 
-		return fmt.Errorf("request failed: %s", response.Error)
+		return &ResponseError{Message: response.Error}
 	}
 
 	return nil
@@ -110,5 +141,5 @@ func parseJSONError(body io.ReadCloser) error {
 		content.Error = "error details not provided"
 	}
 
-	return fmt.Errorf("request failed: %s", content.Error)
+	return &ResponseError{Message: content.Error}
 }
@@ -0,0 +1,133 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+// Revenue properties used by Mixpanel reports.
+const (
+	TransactionsProperty    = "$transactions"
+	AmountProperty          = "$amount"
+	TransactionTimeProperty = "$time"
+	// CurrencyProperty is not used by Mixpanel itself, it is added to keep currency of charge.
+	CurrencyProperty = "currency"
+)
+
+// Charge describes revenue of user profile, negative amount means refund.
+type Charge struct {
+	Amount   float64
+	Currency string
+	// Time of the charge, zero value means current time.
+	Time       time.Time
+	Properties map[string]interface{}
+}
+
+func (c *Charge) validate() error {
+	if math.IsNaN(c.Amount) || math.IsInf(c.Amount, 0) {
+		return fmt.Errorf("invalid charge amount %v", c.Amount)
+	}
+
+	return nil
+}
+
+func (c *Charge) time() time.Time {
+	if c.Time.IsZero() {
+		return time.Now()
+	}
+
+	return c.Time
+}
+
+// Transaction returns action to append charge to `$transactions` list of profile.
+// Extra properties of charge never override `$amount` and `$time`.
+func (c *Charge) Transaction(token, distinctID string) *profile.ListAppend {
+	transaction := make(map[string]interface{}, len(c.Properties)+3)
+	for name, value := range c.Properties {
+		transaction[name] = value
+	}
+
+	if c.Currency != "" {
+		transaction[CurrencyProperty] = c.Currency
+	}
+
+	transaction[AmountProperty] = c.Amount
+	transaction[TransactionTimeProperty] = c.time().UTC().Format("2006-01-02T15:04:05")
+
+	return &profile.ListAppend{
+		Token:      token,
+		DistinctID: distinctID,
+		Append:     map[string]interface{}{TransactionsProperty: transaction},
+	}
+}
+
+// Event returns purchase event with `amount` and `currency` of charge.
+func (c *Charge) Event(name, token, distinctID string) *event.Data {
+	properties := make(event.CustomProperties, len(c.Properties)+2)
+	for key, value := range c.Properties {
+		properties[key] = value
+	}
+
+	if c.Currency != "" {
+		properties[CurrencyProperty] = c.Currency
+	}
+
+	properties["amount"] = c.Amount
+
+	return &event.Data{
+		Event: name,
+		Properties: event.Properties{
+			DistinctID:       distinctID,
+			Time:             c.time(),
+			Token:            token,
+			CustomProperties: properties,
+		},
+	}
+}
+
+// TrackCharge appends charge to `$transactions` of profile and tracks purchase event named eventName,
+// empty name means the event is not tracked. Both items share time of the charge.
+// The event is not tracked if the transaction is not delivered.
+func TrackCharge(
+	ctx context.Context,
+	client Client,
+	token string,
+	distinctID string,
+	charge Charge,
+	eventName string,
+) error {
+	if err := charge.validate(); err != nil {
+		return err
+	}
+
+	// both items must have the same time, even though charge time is not set
+	charge.Time = charge.time()
+
+	if err := client.Engage(ctx, charge.Transaction(token, distinctID)); err != nil {
+		return fmt.Errorf("append transaction: %w", err)
+	}
+
+	if eventName == "" {
+		return nil
+	}
+
+	if err := client.Track(ctx, charge.Event(eventName, token, distinctID)); err != nil {
+		return fmt.Errorf("track %q: %w", eventName, err)
+	}
+
+	return nil
+}
+
+// ClearCharges removes all transactions of profile.
+func ClearCharges(ctx context.Context, client Client, token, distinctID string) error {
+	return client.Engage(ctx, &profile.Unset{
+		Token:      token,
+		DistinctID: distinctID,
+		Unset:      []string{TransactionsProperty},
+	})
+}
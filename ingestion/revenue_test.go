@@ -0,0 +1,79 @@
+package ingestion_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+func Test_TrackCharge(t *testing.T) {
+	recorder := ingestiontest.NewRecorder()
+	charge := ingestion.Charge{
+		Amount:     9.99,
+		Currency:   "EUR",
+		Time:       time.Date(2021, 5, 4, 10, 30, 0, 0, time.FixedZone("CEST", 2*60*60)),
+		Properties: map[string]interface{}{"plan": "premium", "$amount": 0},
+	}
+
+	if err := ingestion.TrackCharge(context.Background(), recorder, "token", "u1", charge, "Purchase"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ingestion.ClearCharges(context.Background(), recorder, "token", "u2"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []profile.Mutator{
+		&profile.ListAppend{Token: "token", DistinctID: "u1", Append: map[string]interface{}{
+			"$transactions": map[string]interface{}{
+				"$amount": 9.99, "$time": "2021-05-04T08:30:00", "currency": "EUR", "plan": "premium",
+			},
+		}},
+		&profile.Unset{Token: "token", DistinctID: "u2", Unset: []string{"$transactions"}},
+	}
+
+	if profiles := recorder.Profiles(); !reflect.DeepEqual(profiles, expected) {
+		t.Fatalf("unexpected profiles: %+v", profiles)
+	}
+
+	events := recorder.EventsByName("Purchase")
+	if len(events) != 1 || !events[0].Properties.Time.Equal(charge.Time) ||
+		events[0].Properties.CustomProperties["amount"] != 9.99 ||
+		events[0].Properties.CustomProperties["currency"] != "EUR" {
+		t.Fatalf("unexpected events: %+v", recorder.Events())
+	}
+}
+
+func Test_TrackCharge_failure(t *testing.T) {
+	recorder := ingestiontest.NewRecorder()
+	failure := errors.New("failure")
+
+	if err := ingestion.TrackCharge(
+		context.Background(), recorder, "token", "u1", ingestion.Charge{Amount: math.NaN()}, "Purchase",
+	); err == nil {
+		t.Fatal("invalid amount is accepted")
+	}
+
+	if err := ingestion.TrackCharge(context.Background(), recorder, "token", "u1", ingestion.Charge{}, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder.FailNext(1, failure)
+
+	if err := ingestion.TrackCharge(
+		context.Background(), recorder, "token", "u1", ingestion.Charge{Amount: -5}, "Refund",
+	); !errors.Is(err, failure) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(recorder.Profiles()) != 1 || len(recorder.Events()) != 0 {
+		t.Fatalf("unexpected calls: %+v", recorder.Calls())
+	}
+}
@@ -0,0 +1,75 @@
+package ingestion
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+// SampleRateProperty is event property which keeps ratio of sampled events to re-weight numbers in reports.
+const SampleRateProperty = "sample_rate"
+
+// SampleEvents returns event interceptor which sends only specified ratio (0, 1] of events by event name,
+// events with other names are not sampled. Events are chosen by hash of distinct ID,
+// so a user is consistently in or out and the same users are kept for all sampled events.
+// Events without distinct ID are chosen by `$insert_id` or randomly if it is empty.
+// Sent events contain SampleRateProperty, rate already set by previous sampling is multiplied.
+func SampleEvents(rates map[string]float64) (EventInterceptor, error) {
+	sampled := make(map[string]float64, len(rates))
+
+	for name, rate := range rates {
+		if rate <= 0 || rate > 1 {
+			return nil, fmt.Errorf("sample rate %v of %q is out of range (0, 1]", rate, name)
+		}
+
+		sampled[name] = rate
+	}
+
+	return func(_ context.Context, data *event.Data) (*event.Data, error) {
+		rate, ok := sampled[data.Event]
+		if !ok {
+			return data, nil
+		}
+
+		if sampleBucket(data) >= rate {
+			return nil, nil
+		}
+
+		if previous, ok := data.Properties.CustomProperties[SampleRateProperty].(float64); ok {
+			rate *= previous
+		}
+
+		custom := make(event.CustomProperties, len(data.Properties.CustomProperties)+1)
+		for name, value := range data.Properties.CustomProperties {
+			custom[name] = value
+		}
+
+		custom[SampleRateProperty] = rate
+
+		weighted := *data
+		weighted.Properties.CustomProperties = custom
+
+		return &weighted, nil
+	}, nil
+}
+
+// sampleBucket returns stable value in range [0, 1) for event.
+func sampleBucket(data *event.Data) float64 {
+	key := data.Properties.DistinctID
+	if key == "" {
+		key = data.Properties.InsertID
+	}
+
+	if key == "" {
+		return rand.Float64()
+	}
+
+	sum := sha256.Sum256([]byte(key))
+
+	// 53 bits fit float64 mantissa
+	return float64(binary.BigEndian.Uint64(sum[:8])>>11) / (1 << 53)
+}
@@ -0,0 +1,100 @@
+package ingestion_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+func Test_SampleEvents(t *testing.T) {
+	for i, rates := range []map[string]float64{{"e": 0}, {"e": 1.5}} {
+		if _, err := ingestion.SampleEvents(rates); err == nil {
+			t.Fatalf("[#%d] expected error for rates %v", i, rates)
+		}
+	}
+
+	sample, err := ingestion.SampleEvents(map[string]float64{"view": 0.25, "click": 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kept := map[string]bool{}
+
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprint("u", i)
+		data := &event.Data{Event: "view", Properties: event.Properties{DistinctID: id}}
+
+		sampled, err := sample(context.Background(), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		again, _ := sample(context.Background(), data)
+		if (sampled == nil) != (again == nil) {
+			t.Fatalf("[%s] user is not consistently sampled", id)
+		}
+
+		if sampled == nil {
+			continue
+		}
+
+		kept[id] = true
+
+		if sampled.Properties.CustomProperties[ingestion.SampleRateProperty] != 0.25 ||
+			data.Properties.CustomProperties != nil {
+			t.Fatalf("[%s] unexpected event: %+v", id, sampled)
+		}
+
+		// lower rate keeps subset of users
+		click, _ := sample(context.Background(), &event.Data{Event: "click", Properties: event.Properties{DistinctID: id}})
+		if click == nil {
+			t.Fatalf("[%s] user is dropped by higher rate", id)
+		}
+	}
+
+	if len(kept) < 200 || len(kept) > 300 {
+		t.Fatalf("unexpected number of sampled users: %d", len(kept))
+	}
+
+	other := &event.Data{Event: "other"}
+	if sampled, _ := sample(context.Background(), other); sampled != other {
+		t.Fatalf("event with other name is sampled: %+v", sampled)
+	}
+}
+
+func Test_Client_sample_events(t *testing.T) {
+	sample, err := ingestion.SampleEvents(map[string]float64{"view": 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+			calls++
+
+			return ResponseStatus(http.StatusOK, req), nil
+		})),
+		ingestion.WithEventInterceptor(sample),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 100; i++ {
+		ctx := ingestion.ContextWithDistinctID(context.Background(), fmt.Sprint("u", i))
+		if err := cli.Track(ctx, &event.Data{Event: "view"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls < 30 || calls > 70 {
+		t.Fatalf("unexpected number of sent events: %d", calls)
+	}
+}
@@ -0,0 +1,128 @@
+package ingestion
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+// PropertyProvider returns value of dynamic super property for event tracked with ctx.
+// Nil value means the property is not set.
+type PropertyProvider func(ctx context.Context) interface{}
+
+// SuperProperties is registry of properties added to every tracked event,
+// like `register` and `register_once` of Mixpanel SDKs.
+// It is safe for concurrent use, so properties may be changed while the client is in use.
+type SuperProperties struct {
+	mu        sync.RWMutex
+	static    event.CustomProperties
+	providers map[string]PropertyProvider
+}
+
+// NewSuperProperties builds empty registry.
+func NewSuperProperties() *SuperProperties {
+	return &SuperProperties{static: event.CustomProperties{}, providers: map[string]PropertyProvider{}}
+}
+
+// Register sets values of super properties, replacing registered ones.
+// Reserved properties like `distinct_id` or `token` are ignored.
+func (s *SuperProperties) Register(properties event.CustomProperties) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, value := range properties {
+		if !reservedProperties[name] {
+			delete(s.providers, name)
+			s.static[name] = value
+		}
+	}
+}
+
+// RegisterOnce sets values of super properties which are not registered yet.
+func (s *SuperProperties) RegisterOnce(properties event.CustomProperties) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, value := range properties {
+		if !reservedProperties[name] && !s.registered(name) {
+			s.static[name] = value
+		}
+	}
+}
+
+// RegisterProvider sets dynamic super property which value is evaluated for every event.
+func (s *SuperProperties) RegisterProvider(name string, provider PropertyProvider) error {
+	switch {
+	case provider == nil:
+		return fmt.Errorf("provider of %q is nil", name)
+	case reservedProperties[name]:
+		return fmt.Errorf("property %q is reserved", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.static, name)
+	s.providers[name] = provider
+
+	return nil
+}
+
+// Unregister removes super properties.
+func (s *SuperProperties) Unregister(names ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, name := range names {
+		delete(s.static, name)
+		delete(s.providers, name)
+	}
+}
+
+func (s *SuperProperties) registered(name string) bool {
+	_, static := s.static[name]
+	_, dynamic := s.providers[name]
+
+	return static || dynamic
+}
+
+// Properties returns values of super properties for event tracked with ctx.
+func (s *SuperProperties) Properties(ctx context.Context) event.CustomProperties {
+	s.mu.RLock()
+	properties := make(event.CustomProperties, len(s.static)+len(s.providers))
+	providers := make(map[string]PropertyProvider, len(s.providers))
+
+	for name, value := range s.static {
+		properties[name] = value
+	}
+
+	for name, provider := range s.providers {
+		providers[name] = provider
+	}
+	s.mu.RUnlock()
+
+	// providers are called without lock, so they may use the registry
+	for name, provider := range providers {
+		if value := provider(ctx); value != nil {
+			properties[name] = value
+		}
+	}
+
+	return properties
+}
+
+// WithSuperProperties makes the client to add super properties to every tracked event.
+// Values set on the event and properties carried by context take precedence over super properties.
+func WithSuperProperties(registry *SuperProperties) ClientOption {
+	return func(c *client) error {
+		if registry == nil {
+			return fmt.Errorf("super properties registry is nil")
+		}
+
+		c.super = registry
+
+		return nil
+	}
+}
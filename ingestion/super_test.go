@@ -0,0 +1,75 @@
+package ingestion_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+func Test_Client_super_properties(t *testing.T) {
+	super := ingestion.NewSuperProperties()
+	super.Register(event.CustomProperties{"app_version": "1.0", "environment": "staging", "token": "ignored"})
+	super.Register(event.CustomProperties{"environment": "production"})
+	super.RegisterOnce(event.CustomProperties{"environment": "test", "region": "eu"})
+
+	calls := 0
+	if err := super.RegisterProvider("call", func(context.Context) interface{} {
+		calls++
+
+		return calls
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := super.RegisterProvider("token", func(context.Context) interface{} { return "t" }); err == nil {
+		t.Fatal("expected error for reserved property")
+	}
+
+	seen := []*event.Data{}
+
+	cli, err := ingestion.NewClient(
+		"https://api.mixpanel.com",
+		ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+			return ResponseStatus(http.StatusOK, req), nil
+		})),
+		ingestion.WithSuperProperties(super),
+		ingestion.WithEventInterceptor(func(_ context.Context, data *event.Data) (*event.Data, error) {
+			seen = append(seen, data)
+
+			return data, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := ingestion.ContextWithProperties(context.Background(), event.CustomProperties{"region": "us"})
+
+	err = cli.Track(ctx, &event.Data{Event: "a", Properties: event.Properties{
+		CustomProperties: event.CustomProperties{"app_version": "2.0"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	super.Unregister("app_version", "call")
+
+	if err := cli.TrackBatch(context.Background(), []*event.Data{{Event: "b"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []event.CustomProperties{
+		{"app_version": "2.0", "environment": "production", "region": "us", "call": 1},
+		{"environment": "production", "region": "eu"},
+	}
+
+	for i, properties := range expected {
+		if !reflect.DeepEqual(seen[i].Properties.CustomProperties, properties) {
+			t.Fatalf("[#%d] expected properties: %v, actual: %v", i, properties, seen[i].Properties.CustomProperties)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package ingestion
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+// DurationProperty is event property which keeps duration of timed event in seconds.
+const DurationProperty = "$duration"
+
+// DefaultTimerTTL is used by NewEventTimers for zero or negative TTL.
+const DefaultTimerTTL = 24 * time.Hour
+
+type timerKey struct {
+	distinctID string
+	event      string
+}
+
+// EventTimers measures time between start of timer and tracking of the event, like `time_event` of Mixpanel SDKs.
+// Timers are keyed by distinct ID and event name, timers which are not finished within TTL are discarded.
+// It is safe for concurrent use.
+type EventTimers struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	started map[timerKey]time.Time
+	swept   time.Time
+}
+
+// NewEventTimers builds registry of timers which are discarded after ttl.
+func NewEventTimers(ttl time.Duration) *EventTimers {
+	if ttl <= 0 {
+		ttl = DefaultTimerTTL
+	}
+
+	return &EventTimers{ttl: ttl, started: map[timerKey]time.Time{}, swept: time.Now()}
+}
+
+// Start starts timer of event for distinct ID, running timer is restarted.
+func (t *EventTimers) Start(distinctID, eventName string) {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.sweep(now)
+	t.started[timerKey{distinctID, eventName}] = now
+}
+
+// Cancel discards timer of event for distinct ID.
+func (t *EventTimers) Cancel(distinctID, eventName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.started, timerKey{distinctID, eventName})
+}
+
+// Elapsed returns time passed since start of timer, false means there is no running timer.
+func (t *EventTimers) Elapsed(distinctID, eventName string) (time.Duration, bool) {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	started, ok := t.started[timerKey{distinctID, eventName}]
+	if !ok || now.Sub(started) >= t.ttl {
+		return 0, false
+	}
+
+	return now.Sub(started), true
+}
+
+// Finish stops timer of the event and returns copy of the event with `$duration` property.
+// Event is returned as is if there is no running timer or the event has `$duration` already.
+func (t *EventTimers) Finish(data *event.Data) *event.Data {
+	now := time.Now()
+
+	t.mu.Lock()
+	key := timerKey{data.Properties.DistinctID, data.Event}
+	started, ok := t.started[key]
+	delete(t.started, key)
+	t.mu.Unlock()
+
+	if !ok || now.Sub(started) >= t.ttl {
+		return data
+	}
+
+	if _, ok := data.Properties.CustomProperties[DurationProperty]; ok {
+		return data
+	}
+
+	custom := make(event.CustomProperties, len(data.Properties.CustomProperties)+1)
+	for name, value := range data.Properties.CustomProperties {
+		custom[name] = value
+	}
+
+	// seconds with millisecond precision as Mixpanel SDKs send it
+	custom[DurationProperty] = math.Round(now.Sub(started).Seconds()*1000) / 1000
+
+	timed := *data
+	timed.Properties.CustomProperties = custom
+
+	return &timed
+}
+
+// sweep discards abandoned timers, at most once per TTL.
+func (t *EventTimers) sweep(now time.Time) {
+	if now.Sub(t.swept) < t.ttl {
+		return
+	}
+
+	for key, started := range t.started {
+		if now.Sub(started) >= t.ttl {
+			delete(t.started, key)
+		}
+	}
+
+	t.swept = now
+}
+
+// WithEventTimers makes the client to finish timers of tracked events.
+// Timer is matched after distinct ID carried by context is applied and event interceptors are called,
+// so interceptors do not see `$duration`, and events dropped by them, e.g. by sampling, do not stop timers.
+// AsyncClient finishes timers on delivery, call Finish before tracking to exclude time in queue.
+func WithEventTimers(timers *EventTimers) ClientOption {
+	return func(c *client) error {
+		if timers == nil {
+			return fmt.Errorf("event timers registry is nil")
+		}
+
+		c.timers = timers
+
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+package ingestion_test
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+)
+
+func Test_Client_event_timers(t *testing.T) {
+	timers := ingestion.NewEventTimers(time.Minute)
+	emulator := ingestiontest.NewEmulator()
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	dropped := false
+	seen := []*event.Data{}
+
+	cli, err := ingestion.NewClient(
+		server.URL,
+		ingestion.WithEventTimers(timers),
+		ingestion.WithEventInterceptor(func(_ context.Context, data *event.Data) (*event.Data, error) {
+			seen = append(seen, data)
+
+			// the first import is dropped like by sampling
+			if data.Event == "import" && !dropped {
+				dropped = true
+
+				return nil, nil
+			}
+
+			return data, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timers.Start("u1", "import")
+	timers.Start("u2", "import")
+	timers.Start("u1", "checkout")
+	timers.Cancel("u1", "checkout")
+	time.Sleep(20 * time.Millisecond)
+
+	ctx := ingestion.ContextWithDistinctID(context.Background(), "u1")
+	tracked := &event.Data{Event: "import"}
+
+	for i := 0; i < 2; i++ {
+		if err := cli.Track(ctx, tracked); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cli.TrackBatch(ctx, []*event.Data{{Event: "import"}, {Event: "checkout"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if tracked.Properties.CustomProperties != nil {
+		t.Fatalf("event of caller is modified: %+v", tracked)
+	}
+
+	for i, data := range seen {
+		if _, ok := data.Properties.CustomProperties[ingestion.DurationProperty]; ok {
+			t.Fatalf("[#%d] interceptor sees duration: %+v", i, data)
+		}
+	}
+
+	events := emulator.Events()
+	if len(events) != 3 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	duration, ok := events[0].Properties.CustomProperties[ingestion.DurationProperty].(float64)
+	if !ok || duration < 0.02 || duration > 1 {
+		t.Fatalf("unexpected duration: %+v", events[0])
+	}
+
+	for i, data := range events[1:] {
+		if _, ok := data.Properties.CustomProperties[ingestion.DurationProperty]; ok {
+			t.Fatalf("[#%d] unexpected duration: %+v", i, data)
+		}
+	}
+
+	if _, ok := timers.Elapsed("u2", "import"); !ok {
+		t.Fatal("timer of other distinct ID is finished")
+	}
+}
+
+func Test_EventTimers_ttl(t *testing.T) {
+	timers := ingestion.NewEventTimers(10 * time.Millisecond)
+	timers.Start("u1", "abandoned")
+	time.Sleep(20 * time.Millisecond)
+
+	data := &event.Data{Event: "abandoned", Properties: event.Properties{DistinctID: "u1"}}
+	if timed := timers.Finish(data); timed != data {
+		t.Fatalf("expired timer is finished: %+v", timed)
+	}
+
+	if _, ok := timers.Elapsed("u1", "abandoned"); ok {
+		t.Fatal("expired timer is running")
+	}
+}
+
+func Test_EventTimers_concurrent(t *testing.T) {
+	timers := ingestion.NewEventTimers(0)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func(id string) {
+			defer wg.Done()
+
+			timers.Start(id, "job")
+			timed := timers.Finish(&event.Data{Event: "job", Properties: event.Properties{DistinctID: id}})
+
+			if _, ok := timed.Properties.CustomProperties[ingestion.DurationProperty]; !ok {
+				t.Errorf("[%s] duration is not set", id)
+			}
+		}(fmt.Sprint("u", i))
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,119 @@
+package ingestion
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+// ErrTokenMismatch is returned when event or profile action has token other than project token of the client.
+var ErrTokenMismatch = errors.New("project token mismatch")
+
+// TokenMismatch describes how the client handles items with token other than project token.
+type TokenMismatch int
+
+const (
+	// RejectTokenMismatch aborts the client call with ErrTokenMismatch.
+	RejectTokenMismatch TokenMismatch = iota
+	// WarnTokenMismatch logs error with the client logger and sends item as is.
+	WarnTokenMismatch
+)
+
+// WithProjectToken sets project token for events and profile actions with empty token.
+// Items of caller are not modified, the token is set on their copies.
+// Items with other token are handled according to mismatch, see WithLogger to get warnings.
+func WithProjectToken(token string, mismatch TokenMismatch) ClientOption {
+	return func(c *client) error {
+		switch {
+		case token == "":
+			return fmt.Errorf("project token is empty")
+		case mismatch != RejectTokenMismatch && mismatch != WarnTokenMismatch:
+			return fmt.Errorf("unknown token mismatch policy %d", mismatch)
+		}
+
+		c.token, c.tokenMismatch = token, mismatch
+
+		return nil
+	}
+}
+
+// injectEventToken returns event with project token.
+func (c *client) injectEventToken(data *event.Data) (*event.Data, error) {
+	switch data.Properties.Token {
+	case c.token:
+		return data, nil
+	case "":
+		injected := *data
+		injected.Properties.Token = c.token
+
+		return &injected, nil
+	}
+
+	return data, c.tokenMismatchError(fmt.Sprintf("event %q", data.Event))
+}
+
+// injectProfileToken returns profile action with project token.
+func (c *client) injectProfileToken(action profile.Mutator) (profile.Mutator, error) {
+	injected, token := copyProfile(action)
+
+	switch {
+	case token == nil || *token == c.token:
+		return action, nil
+	case *token == "":
+		*token = c.token
+
+		return injected, nil
+	}
+
+	return action, c.tokenMismatchError(fmt.Sprintf("profile %q", profile.DistinctID(action)))
+}
+
+func (c *client) tokenMismatchError(item string) error {
+	if c.tokenMismatch == RejectTokenMismatch {
+		return fmt.Errorf("%w: %s", ErrTokenMismatch, item)
+	}
+
+	if c.logger != nil {
+		c.logger.Error("mixpanel token mismatch", "item", item)
+	}
+
+	return nil
+}
+
+// copyProfile returns shallow copy of profile action and pointer to its token, or nil for unknown action.
+func copyProfile(action profile.Mutator) (profile.Mutator, *string) {
+	switch a := action.(type) {
+	case *profile.Set:
+		cp := *a
+
+		return &cp, &cp.Token
+	case *profile.SetOnce:
+		cp := *a
+
+		return &cp, &cp.Token
+	case *profile.NumberAdd:
+		cp := *a
+
+		return &cp, &cp.Token
+	case *profile.ListAppend:
+		cp := *a
+
+		return &cp, &cp.Token
+	case *profile.ListRemove:
+		cp := *a
+
+		return &cp, &cp.Token
+	case *profile.Unset:
+		cp := *a
+
+		return &cp, &cp.Token
+	case *profile.Delete:
+		cp := *a
+
+		return &cp, &cp.Token
+	}
+
+	return action, nil
+}
@@ -0,0 +1,114 @@
+package ingestion_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+func Test_Client_project_token(t *testing.T) {
+	emulator := ingestiontest.NewEmulator(ingestiontest.WithProjectToken("project-token"))
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	cli, err := ingestion.NewClient(server.URL, ingestion.WithProjectToken("project-token", ingestion.RejectTokenMismatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := &event.Data{Event: "e1", Properties: event.Properties{DistinctID: "u1"}}
+	if err := cli.Track(context.Background(), data); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := []*event.Data{
+		{Event: "e2", Properties: event.Properties{DistinctID: "u1"}},
+		{Event: "e3", Properties: event.Properties{DistinctID: "u1", Token: "project-token"}},
+	}
+	if err := cli.TrackBatch(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+
+	set := &profile.Set{DistinctID: "u1", Set: map[string]interface{}{"plan": "premium"}}
+	if err := cli.Engage(context.Background(), set); err != nil {
+		t.Fatal(err)
+	}
+
+	actions := []profile.Mutator{&profile.Unset{DistinctID: "u1", Unset: []string{"plan"}}}
+	if err := cli.EngageBatch(context.Background(), actions); err != nil {
+		t.Fatal(err)
+	}
+
+	if data.Properties.Token != "" || batch[0].Properties.Token != "" || set.Token != "" ||
+		actions[0].(*profile.Unset).Token != "" {
+		t.Fatal("items of caller are modified")
+	}
+
+	if events := emulator.Events(); len(events) != 3 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func Test_Client_project_token_mismatch(t *testing.T) {
+	logger := &LoggerMock{}
+	calls := 0
+
+	options := func(mismatch ingestion.TokenMismatch) []ingestion.ClientOption {
+		return []ingestion.ClientOption{
+			ingestion.WithHTTPDoer(HTTPDoerMock(func(req *http.Request) (*http.Response, error) {
+				calls++
+
+				return ResponseStatus(http.StatusOK, req), nil
+			})),
+			ingestion.WithLogger(logger),
+			ingestion.WithProjectToken("project-token", mismatch),
+		}
+	}
+
+	rejecting, err := ingestion.NewClient("https://api.mixpanel.com", options(ingestion.RejectTokenMismatch)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warning, err := ingestion.NewClient("https://api.mixpanel.com", options(ingestion.WarnTokenMismatch)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := &event.Data{Event: "e", Properties: event.Properties{Token: "other-token"}}
+	action := &profile.Set{Token: "other-token", DistinctID: "u1"}
+
+	cases := []struct {
+		call     func() error
+		rejected bool
+	}{
+		{func() error { return rejecting.Track(context.Background(), data) }, true},
+		{func() error { return rejecting.TrackBatch(context.Background(), []*event.Data{data}) }, true},
+		{func() error { return rejecting.Engage(context.Background(), action) }, true},
+		{func() error { return rejecting.EngageBatch(context.Background(), []profile.Mutator{action}) }, true},
+		{func() error { return warning.Track(context.Background(), data) }, false},
+		{func() error { return warning.Engage(context.Background(), action) }, false},
+	}
+
+	for i, c := range cases {
+		err := c.call()
+		if c.rejected != errors.Is(err, ingestion.ErrTokenMismatch) || !c.rejected && err != nil {
+			t.Fatalf("[#%d] unexpected error: %v", i, err)
+		}
+	}
+
+	if calls != 2 || len(logger.lines) != 2 {
+		t.Fatalf("unexpected calls %d and log: %v", calls, logger.lines)
+	}
+
+	if _, err := ingestion.NewClient("https://api.mixpanel.com", ingestion.WithProjectToken("", 0)); err == nil {
+		t.Fatal("empty token is accepted")
+	}
+}
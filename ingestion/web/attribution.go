@@ -0,0 +1,154 @@
+package web
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+)
+
+// CampaignParams lists parameters of landing URL recorded by Mixpanel JavaScript SDK:
+// UTM parameters and click IDs of ad networks.
+var CampaignParams = []string{
+	"utm_source", "utm_medium", "utm_campaign", "utm_content", "utm_term",
+	"dclid", "fbclid", "gclid", "ko_click_id", "li_fat_id", "msclkid", "ttclid", "twclid", "wbraid",
+}
+
+// Attribution properties.
+const (
+	PropertyReferrer               = "$referrer"
+	PropertyReferringDomain        = "$referring_domain"
+	PropertyInitialReferrer        = "$initial_referrer"
+	PropertyInitialReferringDomain = "$initial_referring_domain"
+	PropertySearchEngine           = "$search_engine"
+	PropertySearchKeyword          = "mp_keyword"
+)
+
+// directReferrer is the value of initial referrer of visits without referrer.
+const directReferrer = "$direct"
+
+// searchEngines detects search engine by referrer, keyword is taken from query parameter.
+var searchEngines = []struct {
+	name, param string
+	pattern     *regexp.Regexp
+}{
+	{"google", "q", regexp.MustCompile(`^https?://(.*)google\.([^/?]*)`)},
+	{"bing", "q", regexp.MustCompile(`^https?://(.*)bing\.com`)},
+	{"yahoo", "p", regexp.MustCompile(`^https?://(.*)yahoo\.com`)},
+	{"duckduckgo", "q", regexp.MustCompile(`^https?://(.*)duckduckgo\.com`)},
+}
+
+// Attribution describes marketing source of visit like Mixpanel JavaScript SDK does.
+type Attribution struct {
+	// Campaign contains non-empty CampaignParams of landing URL.
+	Campaign map[string]string
+	// Referrer is URL of referring page, empty for direct visits.
+	Referrer string
+	// ReferringDomain is host of Referrer.
+	ReferringDomain string
+	// SearchEngine is the name of search engine which referred the visit, if any.
+	SearchEngine string
+	// SearchKeyword is the search query of SearchEngine, if it is known.
+	SearchKeyword string
+}
+
+// ParseAttribution parses landing URL and referrer, e.g. from Referer header of landing page request.
+func ParseAttribution(landingURL, referrer string) (*Attribution, error) {
+	landing, err := url.Parse(landingURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse landing URL: %w", err)
+	}
+
+	a := &Attribution{Campaign: map[string]string{}, Referrer: referrer}
+	query := landing.Query()
+
+	for _, param := range CampaignParams {
+		if value := query.Get(param); value != "" {
+			a.Campaign[param] = value
+		}
+	}
+
+	if referrer == "" {
+		return a, nil
+	}
+
+	ref, err := url.Parse(referrer)
+	if err != nil {
+		return nil, fmt.Errorf("parse referrer: %w", err)
+	}
+
+	a.ReferringDomain = ref.Hostname()
+
+	for _, engine := range searchEngines {
+		if engine.pattern.MatchString(referrer) {
+			a.SearchEngine = engine.name
+			a.SearchKeyword = ref.Query().Get(engine.param)
+
+			break
+		}
+	}
+
+	return a, nil
+}
+
+// Properties returns event properties of attribution.
+func (a *Attribution) Properties() event.CustomProperties {
+	properties := event.CustomProperties{}
+
+	for param, value := range a.Campaign {
+		properties[param] = value
+	}
+
+	if a.Referrer != "" {
+		properties[PropertyReferrer] = a.Referrer
+		properties[PropertyReferringDomain] = a.ReferringDomain
+	}
+
+	if a.SearchEngine != "" {
+		properties[PropertySearchEngine] = a.SearchEngine
+	}
+
+	if a.SearchKeyword != "" {
+		properties[PropertySearchKeyword] = a.SearchKeyword
+	}
+
+	return properties
+}
+
+// FirstTouch returns profile action to keep the first known source of user:
+// `$initial_referrer` and `$initial_referring_domain`, which are "$direct" for direct visits,
+// and campaign parameters with "initial_" prefix.
+func (a *Attribution) FirstTouch(token, distinctID string) *profile.SetOnce {
+	referrer, domain := a.Referrer, a.ReferringDomain
+	if referrer == "" {
+		referrer, domain = directReferrer, directReferrer
+	}
+
+	values := map[string]interface{}{
+		PropertyInitialReferrer:        referrer,
+		PropertyInitialReferringDomain: domain,
+	}
+
+	for param, value := range a.Campaign {
+		values["initial_"+param] = value
+	}
+
+	return &profile.SetOnce{Token: token, DistinctID: distinctID, SetOnce: values}
+}
+
+// LastTouch returns profile action to overwrite campaign parameters with " [last touch]" suffix.
+// False means landing URL has no campaign parameters and nothing should be sent, so the last known campaign is kept.
+func (a *Attribution) LastTouch(token, distinctID string) (*profile.Set, bool) {
+	if len(a.Campaign) == 0 {
+		return nil, false
+	}
+
+	values := map[string]interface{}{}
+	for param, value := range a.Campaign {
+		values[param+" [last touch]"] = value
+	}
+
+	return &profile.Set{Token: token, DistinctID: distinctID, Set: values}, true
+}
@@ -0,0 +1,102 @@
+package web_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/ingestion/web"
+)
+
+func TestParseAttribution(t *testing.T) {
+	a, err := web.ParseAttribution(
+		"https://shop.example.com/?utm_source=newsletter&utm_campaign=spring&gclid=abc&utm_term=",
+		"https://www.google.co.uk/search?q=red+shoes",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := event.CustomProperties{
+		"utm_source":                "newsletter",
+		"utm_campaign":              "spring",
+		"gclid":                     "abc",
+		web.PropertyReferrer:        "https://www.google.co.uk/search?q=red+shoes",
+		web.PropertyReferringDomain: "www.google.co.uk",
+		web.PropertySearchEngine:    "google",
+		web.PropertySearchKeyword:   "red shoes",
+	}
+	if actual := a.Properties(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected properties: %v, actual: %v", expected, actual)
+	}
+
+	first := a.FirstTouch("token", "u1")
+	if first.DistinctID != "u1" || first.SetOnce["initial_utm_source"] != "newsletter" ||
+		first.SetOnce[web.PropertyInitialReferringDomain] != "www.google.co.uk" {
+		t.Fatalf("unexpected first touch: %+v", first)
+	}
+
+	last, ok := a.LastTouch("token", "u1")
+	if !ok || len(last.Set) != 3 || last.Set["utm_campaign [last touch]"] != "spring" {
+		t.Fatalf("unexpected last touch: %+v", last)
+	}
+}
+
+func TestParseAttribution_direct(t *testing.T) {
+	a, err := web.ParseAttribution("https://shop.example.com/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if properties := a.Properties(); len(properties) != 0 {
+		t.Fatalf("unexpected properties: %v", properties)
+	}
+
+	if last, ok := a.LastTouch("token", "u1"); ok || last != nil {
+		t.Fatalf("unexpected last touch: %+v", last)
+	}
+
+	expected := map[string]interface{}{
+		web.PropertyInitialReferrer:        "$direct",
+		web.PropertyInitialReferringDomain: "$direct",
+	}
+	if first := a.FirstTouch("token", "u1"); !reflect.DeepEqual(first.SetOnce, expected) {
+		t.Fatalf("unexpected first touch: %+v", first)
+	}
+
+	a, err = web.ParseAttribution("https://shop.example.com/", "https://search.yahoo.com/search?p=shoes")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.SearchEngine != "yahoo" || a.SearchKeyword != "shoes" {
+		t.Fatalf("unexpected search attribution: %+v", a)
+	}
+}
+
+func TestAttribution_engage(t *testing.T) {
+	recorder := ingestiontest.NewRecorder()
+
+	for i, landing := range []string{"https://shop.example.com/", "https://shop.example.com/?utm_source=ads"} {
+		a, err := web.ParseAttribution(landing, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := recorder.Engage(context.Background(), a.FirstTouch("token", "u1")); err != nil {
+			t.Fatalf("[#%d] %s", i, err)
+		}
+
+		if last, ok := a.LastTouch("token", "u1"); ok {
+			if err := recorder.Engage(context.Background(), last); err != nil {
+				t.Fatalf("[#%d] %s", i, err)
+			}
+		}
+	}
+
+	if profiles := recorder.Profiles(); len(profiles) != 3 {
+		t.Fatalf("unexpected profile actions: %+v", profiles)
+	}
+}
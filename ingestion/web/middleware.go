@@ -0,0 +1,318 @@
+package web
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+// DefaultRequestEvent is the name of events tracked by middleware.
+const DefaultRequestEvent = "HTTP Request"
+
+// Properties of events tracked by middleware.
+const (
+	PropertyMethod        = "method"
+	PropertyRoute         = "route"
+	PropertyStatus        = "status"
+	PropertyLatency       = "latency_ms"
+	PropertyResponseBytes = "response_bytes"
+	PropertySampleRate    = ingestion.SampleRateProperty
+)
+
+// middleware tracks served requests.
+type middleware struct {
+	client     *ingestion.AsyncClient
+	name       string
+	token      string
+	route      func(*http.Request) string
+	distinctID func(*http.Request) string
+	properties []func(*http.Request, *event.Properties)
+	excluded   []string
+	sampleRate float64
+	onError    func(*http.Request, error)
+}
+
+// MiddlewareOption customizes middleware built by NewMiddleware.
+type MiddlewareOption func(*middleware) error
+
+// NewMiddleware builds net/http middleware which tracks event per served request
+// with method, route, status, latency and size of response body.
+// Events are queued to AsyncClient after the handler returns, so tracking does not delay responses.
+// Distinct ID and properties of request context, see ingestion.ContextWithProperties, are added to events.
+func NewMiddleware(
+	client *ingestion.AsyncClient,
+	options ...MiddlewareOption,
+) (func(http.Handler) http.Handler, error) {
+	if client == nil {
+		return nil, fmt.Errorf("client is nil")
+	}
+
+	m := &middleware{
+		client:     client,
+		name:       DefaultRequestEvent,
+		route:      func(r *http.Request) string { return r.URL.Path },
+		sampleRate: 1,
+	}
+
+	for _, option := range options {
+		if err := option(m); err != nil {
+			return nil, fmt.Errorf("middleware option: %w", err)
+		}
+	}
+
+	return m.wrap, nil
+}
+
+// WithEventName sets name of tracked events, default is DefaultRequestEvent.
+func WithEventName(name string) MiddlewareOption {
+	return func(m *middleware) error {
+		if name == "" {
+			return fmt.Errorf("event name is empty")
+		}
+
+		m.name = name
+
+		return nil
+	}
+}
+
+// WithProjectToken sets project token of tracked events.
+func WithProjectToken(token string) MiddlewareOption {
+	return func(m *middleware) error {
+		m.token = token
+
+		return nil
+	}
+}
+
+// WithRoute sets func which returns route of request, default is path of request URL.
+// Use it to track route patterns of your router instead of raw paths with IDs.
+// Func is called after the handler, when router has already matched the request.
+// Requests with empty route are not tracked.
+func WithRoute(route func(*http.Request) string) MiddlewareOption {
+	return func(m *middleware) error {
+		if route == nil {
+			return fmt.Errorf("route func is nil")
+		}
+
+		m.route = route
+
+		return nil
+	}
+}
+
+// WithDistinctID sets func which extracts distinct ID of user from request, e.g. from authentication context.
+func WithDistinctID(distinctID func(*http.Request) string) MiddlewareOption {
+	return func(m *middleware) error {
+		if distinctID == nil {
+			return fmt.Errorf("distinct ID func is nil")
+		}
+
+		m.distinctID = distinctID
+
+		return nil
+	}
+}
+
+// WithProperties registers funcs which add properties of request to tracked events.
+// Funcs are called in order of registration after the handler returns.
+func WithProperties(properties ...func(*http.Request, *event.Properties)) MiddlewareOption {
+	return func(m *middleware) error {
+		for i, p := range properties {
+			if p == nil {
+				return fmt.Errorf("properties func #%d is nil", i)
+			}
+		}
+
+		m.properties = append(m.properties, properties...)
+
+		return nil
+	}
+}
+
+// WithExcludedRoutes excludes routes matching any of patterns from tracking,
+// e.g. "/healthz" or "/static/*". Patterns are matched with path.Match.
+func WithExcludedRoutes(patterns ...string) MiddlewareOption {
+	return func(m *middleware) error {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("excluded route %q: %w", pattern, err)
+			}
+		}
+
+		m.excluded = append(m.excluded, patterns...)
+
+		return nil
+	}
+}
+
+// WithSampleRate tracks only specified ratio (0, 1] of requests chosen randomly.
+// Events of sampled requests contain PropertySampleRate to re-weight numbers in reports.
+func WithSampleRate(rate float64) MiddlewareOption {
+	return func(m *middleware) error {
+		if rate <= 0 || rate > 1 {
+			return fmt.Errorf("sample rate %v is out of range (0, 1]", rate)
+		}
+
+		m.sampleRate = rate
+
+		return nil
+	}
+}
+
+// WithErrorHandler sets callback for events which were not queued, e.g. because of ingestion.ErrQueueFull.
+func WithErrorHandler(onError func(*http.Request, error)) MiddlewareOption {
+	return func(m *middleware) error {
+		m.onError = onError
+
+		return nil
+	}
+}
+
+func (m *middleware) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		rw := &responseWriter{ResponseWriter: w}
+
+		next.ServeHTTP(rw.exposed(), r)
+
+		if data := m.makeEvent(r, rw, started); data != nil {
+			// AsyncClient only takes values of context, so canceled context of request is fine here.
+			if err := m.client.Track(r.Context(), data); err != nil && m.onError != nil {
+				m.onError(r, err)
+			}
+		}
+	})
+}
+
+// makeEvent returns event of served request or nil if request is not tracked.
+func (m *middleware) makeEvent(r *http.Request, rw *responseWriter, started time.Time) *event.Data {
+	route := m.route(r)
+	if route == "" || m.isExcluded(route) {
+		return nil
+	}
+
+	if m.sampleRate < 1 && rand.Float64() >= m.sampleRate {
+		return nil
+	}
+
+	data := &event.Data{
+		Event: m.name,
+		Properties: event.Properties{
+			Time:  started,
+			Token: m.token,
+			CustomProperties: event.CustomProperties{
+				PropertyMethod:        r.Method,
+				PropertyRoute:         route,
+				PropertyStatus:        rw.statusCode(),
+				PropertyLatency:       float64(time.Since(started).Microseconds()) / 1000,
+				PropertyResponseBytes: rw.written,
+			},
+		},
+	}
+
+	if m.sampleRate < 1 {
+		data.Properties.CustomProperties[PropertySampleRate] = m.sampleRate
+	}
+
+	if m.distinctID != nil {
+		data.Properties.DistinctID = m.distinctID(r)
+	}
+
+	for _, properties := range m.properties {
+		properties(r, &data.Properties)
+	}
+
+	return data
+}
+
+func (m *middleware) isExcluded(route string) bool {
+	for _, pattern := range m.excluded {
+		if ok, _ := path.Match(pattern, route); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// responseWriter captures status and size of response.
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+
+	return n, err
+}
+
+func (w *responseWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+
+	return w.status
+}
+
+// exposed returns writer passed to the handler, it implements http.Flusher only if underlying writer does,
+// so the handler is able to detect support of streaming.
+func (w *responseWriter) exposed() http.ResponseWriter {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		return &flushWriter{responseWriter: w, flusher: f}
+	}
+
+	return w
+}
+
+// Hijack implements http.Hijacker interface if underlying writer does.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+
+	return h.Hijack()
+}
+
+// Unwrap returns underlying writer for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flushWriter is responseWriter over writer which implements http.Flusher.
+type flushWriter struct {
+	*responseWriter
+	flusher http.Flusher
+}
+
+// Flush implements http.Flusher interface.
+func (w *flushWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	w.flusher.Flush()
+}
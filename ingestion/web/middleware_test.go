@@ -0,0 +1,195 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/ingestion/web"
+)
+
+func TestMiddleware(t *testing.T) {
+	recorder := ingestiontest.NewRecorder()
+
+	client, err := ingestion.NewAsyncClient(recorder, ingestion.AsyncSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track, err := web.NewMiddleware(
+		client,
+		web.WithProjectToken("token"),
+		web.WithRoute(func(r *http.Request) string {
+			if strings.HasPrefix(r.URL.Path, "/users/") {
+				return "/users/{id}"
+			}
+
+			return r.URL.Path
+		}),
+		web.WithDistinctID(func(r *http.Request) string { return r.Header.Get("X-User") }),
+		web.WithExcludedRoutes("/healthz", "/static/*"),
+		web.WithProperties(func(r *http.Request, p *event.Properties) {
+			p.CustomProperties["client"] = r.Header.Get("X-Client")
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	for _, target := range []string{"/users/42", "/missing", "/healthz", "/static/app.js"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("X-User", "u1")
+		req.Header.Set("X-Client", "test")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	events := recorder.Events()
+	if len(events) != 2 {
+		t.Fatalf("unexpected number of events: %d", len(events))
+	}
+
+	expected := []map[string]interface{}{
+		{web.PropertyRoute: "/users/{id}", web.PropertyStatus: 200, web.PropertyResponseBytes: int64(5)},
+		{web.PropertyRoute: "/missing", web.PropertyStatus: 404},
+	}
+
+	for i, data := range events {
+		if data.Event != web.DefaultRequestEvent || data.Properties.Token != "token" || data.Properties.DistinctID != "u1" {
+			t.Fatalf("[#%d] unexpected event: %+v", i, data)
+		}
+
+		properties := data.Properties.CustomProperties
+		if properties[web.PropertyMethod] != http.MethodGet || properties["client"] != "test" {
+			t.Fatalf("[#%d] unexpected properties: %v", i, properties)
+		}
+
+		for name, value := range expected[i] {
+			if properties[name] != value {
+				t.Fatalf("[#%d] expected %s: %v, actual: %v", i, name, value, properties[name])
+			}
+		}
+	}
+}
+
+func TestMiddleware_sampling(t *testing.T) {
+	recorder := ingestiontest.NewRecorder()
+
+	client, err := ingestion.NewAsyncClient(recorder, ingestion.AsyncSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := web.NewMiddleware(client, web.WithSampleRate(0)); err == nil {
+		t.Fatal("expected error for zero sample rate")
+	}
+
+	track, err := web.NewMiddleware(client, web.WithSampleRate(0.25))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := track(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	for i := 0; i < 1000; i++ {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	events := recorder.Events()
+	if len(events) < 150 || len(events) > 350 {
+		t.Fatalf("unexpected number of sampled events: %d", len(events))
+	}
+
+	if rate := events[0].Properties.CustomProperties[web.PropertySampleRate]; rate != 0.25 {
+		t.Fatalf("unexpected sample rate property: %v", rate)
+	}
+}
+
+func TestMiddleware_request_context(t *testing.T) {
+	recorder := ingestiontest.NewRecorder()
+
+	client, err := ingestion.NewAsyncClient(recorder, ingestion.AsyncSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	track, err := web.NewMiddleware(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := track(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+
+	ctx := ingestion.ContextWithDistinctID(context.Background(), "u1")
+	ctx = ingestion.ContextWithProperties(ctx, event.CustomProperties{"tenant": "acme"})
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	events := recorder.Events()
+	if len(events) != 1 {
+		t.Fatalf("unexpected number of events: %d", len(events))
+	}
+
+	if p := events[0].Properties; p.DistinctID != "u1" || p.CustomProperties["tenant"] != "acme" {
+		t.Fatalf("unexpected properties: %+v", p)
+	}
+}
+
+func TestMiddleware_flusher(t *testing.T) {
+	client, err := ingestion.NewAsyncClient(ingestiontest.NewRecorder(), ingestion.AsyncSettings{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	track, err := web.NewMiddleware(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flushable := false
+	handler := track(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flushable = w.(http.Flusher)
+	}))
+
+	cases := []struct {
+		w        http.ResponseWriter
+		expected bool
+	}{
+		{httptest.NewRecorder(), true},
+		{struct{ http.ResponseWriter }{httptest.NewRecorder()}, false},
+	}
+
+	for i, c := range cases {
+		handler.ServeHTTP(c.w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if flushable != c.expected {
+			t.Fatalf("[#%d] expected http.Flusher: %v, actual: %v", i, c.expected, flushable)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+// Package web integrates Mixpanel Ingestion API with net/http servers.
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/profile"
+	"github.com/wtask-go/mixpanel/internal/form"
+)
+
+// maxRequestSize limits size of SDK request body.
+const maxRequestSize = 4 << 20
+
+// callbackPattern allows only dotted JavaScript identifiers as JSONP callback.
+var callbackPattern = regexp.MustCompile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)*$`)
+
+// pixel is 1x1 transparent PNG image served in response to `img=1` requests.
+var pixel = func() []byte {
+	buf := &bytes.Buffer{}
+	_ = png.Encode(buf, image.NewNRGBA(image.Rect(0, 0, 1, 1)))
+
+	return buf.Bytes()
+}()
+
+// Proxy is http.Handler which accepts requests of official Mixpanel SDKs on `/track` and `/engage` paths
+// and forwards decoded events and profile actions through ingestion.Client.
+// Serve it from your own domain to keep tracking requests from being blocked by ad blockers.
+//
+// Proxy supports GET and POST requests with `data` as JSON or base64-encoded JSON
+// and responds according to `verbose`, `img`, `redirect` and `callback` parameters as Mixpanel does.
+// Malformed and rejected items are reported with status 0, while transport errors, open circuit breaker
+// and temporary failures of Mixpanel are reported with 5xx status, so SDKs retry them later.
+//
+// Event batches larger than ingestion.TrackBatchLimit are sent in sequential chunks. If a chunk fails,
+// SDK retries the whole batch including chunks which were already accepted, so events without `$insert_id`
+// get one derived from their content and Mixpanel deduplicates resent events.
+type Proxy struct {
+	client    ingestion.Client
+	clientIP  IPResolver
+	redirects map[string]bool
+}
+
+// IPResolver returns IP address of client which sent the request, or empty string if it is unknown.
+type IPResolver func(*http.Request) string
+
+// ProxyOption customizes Proxy.
+type ProxyOption func(*Proxy) error
+
+// NewProxy builds Proxy which forwards SDK requests through the client.
+func NewProxy(client ingestion.Client, options ...ProxyOption) (*Proxy, error) {
+	if client == nil {
+		return nil, fmt.Errorf("client is nil")
+	}
+
+	p := &Proxy{client: client, redirects: map[string]bool{}}
+
+	for _, option := range options {
+		if err := option(p); err != nil {
+			return nil, fmt.Errorf("proxy option: %w", err)
+		}
+	}
+
+	return p, nil
+}
+
+// WithClientIP makes Proxy to set IP of SDK client to events without `ip` property,
+// if SDK asks Mixpanel to use IP of request with `ip=1` parameter.
+// Otherwise Mixpanel would see IP of the server where Proxy runs.
+func WithClientIP(resolver IPResolver) ProxyOption {
+	return func(p *Proxy) error {
+		if resolver == nil {
+			return fmt.Errorf("IP resolver is nil")
+		}
+
+		p.clientIP = resolver
+
+		return nil
+	}
+}
+
+// WithRedirectHosts allows `redirect` parameter to point to specified hosts.
+// Relative URLs are always allowed, others are refused to keep Proxy from being open redirect.
+func WithRedirectHosts(hosts ...string) ProxyOption {
+	return func(p *Proxy) error {
+		for _, host := range hosts {
+			p.redirects[strings.ToLower(host)] = true
+		}
+
+		return nil
+	}
+}
+
+// RemoteIP is IPResolver which returns IP of http.Request.RemoteAddr.
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// ServeHTTP implements http.Handler interface.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Requested-With")
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	case http.MethodGet, http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST, OPTIONS")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	var send func(context.Context, []json.RawMessage, *http.Request) error
+
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/track":
+		send = p.track
+	case "/engage":
+		send = p.engage
+	default:
+		http.NotFound(w, r)
+
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if err := p.checkResponseParams(r.Form); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	items, _, err := form.DecodeItems(r.Form.Get("data"))
+	if err != nil {
+		respond(w, r, &ingestion.ResponseError{Message: err.Error()})
+
+		return
+	}
+
+	respond(w, r, send(r.Context(), items, r))
+}
+
+// checkResponseParams validates parameters which control response.
+func (p *Proxy) checkResponseParams(params url.Values) error {
+	if callback := params.Get("callback"); callback != "" && !callbackPattern.MatchString(callback) {
+		return fmt.Errorf("invalid callback")
+	}
+
+	redirect := params.Get("redirect")
+	if redirect == "" {
+		return nil
+	}
+
+	// browsers treat backslash as slash, so `/\evil.com` would redirect to other host
+	if strings.Contains(redirect, `\`) {
+		return fmt.Errorf("invalid redirect: backslash is not allowed")
+	}
+
+	target, err := url.Parse(redirect)
+	if err != nil {
+		return fmt.Errorf("invalid redirect: %w", err)
+	}
+
+	if target.Host != "" && !p.redirects[strings.ToLower(target.Hostname())] {
+		return fmt.Errorf("redirect to %s is not allowed", target.Host)
+	}
+
+	if target.Host == "" &&
+		(target.Scheme != "" || !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//")) {
+		return fmt.Errorf("redirect must be absolute path or URL of allowed host")
+	}
+
+	return nil
+}
+
+func (p *Proxy) track(ctx context.Context, items []json.RawMessage, r *http.Request) error {
+	ip := ""
+	if p.clientIP != nil && r.Form.Get("ip") == "1" {
+		ip = p.clientIP(r)
+	}
+
+	batch := make([]*event.Data, 0, len(items))
+
+	for i, item := range items {
+		data := &event.Data{}
+		if err := json.Unmarshal(item, data); err != nil {
+			return &ingestion.ResponseError{Message: fmt.Sprintf("event #%d: %s", i, err)}
+		}
+
+		if data.Properties.IP == "" {
+			data.Properties.IP = ip
+		}
+
+		if data.Properties.InsertID == "" {
+			data.Properties.InsertID = itemInsertID(item)
+		}
+
+		batch = append(batch, data)
+	}
+
+	if len(batch) == 1 {
+		return p.client.Track(ctx, batch[0])
+	}
+
+	for len(batch) > 0 {
+		size := len(batch)
+		if size > ingestion.TrackBatchLimit {
+			size = ingestion.TrackBatchLimit
+		}
+
+		if err := p.client.TrackBatch(ctx, batch[:size]); err != nil {
+			return err
+		}
+
+		batch = batch[size:]
+	}
+
+	return nil
+}
+
+// itemInsertID derives `$insert_id` from raw item, so the same item resent by SDK gets the same ID.
+func itemInsertID(item json.RawMessage) string {
+	sum := sha256.Sum256(item)
+
+	return hex.EncodeToString(sum[:16])
+}
+
+// engage forwards profile actions, profile models do not keep IP, so client IP is not applied to them.
+func (p *Proxy) engage(ctx context.Context, items []json.RawMessage, _ *http.Request) error {
+	batch := make([]profile.Mutator, 0, len(items))
+
+	for i, item := range items {
+		action, err := profile.UnmarshalMutator(item)
+		if err != nil {
+			return &ingestion.ResponseError{Message: fmt.Sprintf("profile action #%d: %s", i, err)}
+		}
+
+		batch = append(batch, action)
+	}
+
+	if len(batch) == 1 {
+		return p.client.Engage(ctx, batch[0])
+	}
+
+	return p.client.EngageBatch(ctx, batch)
+}
+
+// retryStatus returns 5xx status for errors which may not happen if SDK retries request later,
+// or zero for errors which reject items.
+func retryStatus(err error) int {
+	var (
+		respErr *ingestion.ResponseError
+		netErr  net.Error
+	)
+
+	switch {
+	case errors.As(err, &respErr):
+		if respErr.Temporary() {
+			return respErr.StatusCode
+		}
+	case errors.Is(err, ingestion.ErrCircuitOpen),
+		errors.Is(err, ingestion.ErrQueueFull),
+		errors.Is(err, ingestion.ErrClientClosed):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &netErr):
+		return http.StatusBadGateway
+	}
+
+	return 0
+}
+
+// respond writes response expected by SDK.
+// Rejected items result in status 0, failures which may be retried result in 5xx status, see retryStatus.
+func respond(w http.ResponseWriter, r *http.Request, err error) {
+	if status := retryStatus(err); status != 0 {
+		http.Error(w, http.StatusText(status), status)
+
+		return
+	}
+
+	result := struct {
+		Status int    `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}{Status: 1}
+
+	var respErr *ingestion.ResponseError
+
+	switch {
+	case errors.As(err, &respErr) && respErr.Message != "":
+		result.Status, result.Error = 0, respErr.Message
+	case err != nil:
+		result.Status, result.Error = 0, err.Error()
+	}
+
+	verbose, _ := json.Marshal(result)
+	if r.Form.Get("verbose") != "1" {
+		verbose = []byte(fmt.Sprint(result.Status))
+	}
+
+	switch {
+	case r.Form.Get("redirect") != "":
+		http.Redirect(w, r, r.Form.Get("redirect"), http.StatusFound)
+	case r.Form.Get("img") == "1" || r.Form.Get("image") == "1":
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+		_, _ = w.Write(pixel)
+	case r.Form.Get("callback") != "":
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		_, _ = fmt.Fprintf(w, "%s(%s);", r.Form.Get("callback"), verbose)
+	case r.Form.Get("verbose") == "1":
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(verbose)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write(verbose)
+	}
+}
@@ -0,0 +1,286 @@
+package web_test
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion"
+	"github.com/wtask-go/mixpanel/ingestion/ingestiontest"
+	"github.com/wtask-go/mixpanel/ingestion/web"
+)
+
+func TestProxy(t *testing.T) {
+	emulator := ingestiontest.NewEmulator(ingestiontest.WithProjectToken("token"))
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	client, err := ingestion.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy, err := web.NewProxy(client, web.WithClientIP(web.RemoteIP), web.WithRedirectHosts("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch := base64.StdEncoding.EncodeToString([]byte(
+		`[{"event":"a","properties":{"token":"token"}},{"event":"b","properties":{"token":"token","ip":"10.0.0.1"}}]`,
+	))
+	event := `{"event":"c","properties":{"token":"token","distinct_id":"u1"}}`
+	data := "&data=" + url.QueryEscape(event)
+
+	cases := []struct {
+		method, target string
+		form           url.Values
+		status         int
+		contentType    string
+		body           string
+	}{
+		{http.MethodGet, "/track/?ip=1&data=" + url.QueryEscape(batch), nil, 200, "text/plain", "1"},
+		{http.MethodPost, "/track", url.Values{"data": {event}, "verbose": {"1"}}, 200, "application/json", `{"status":1}`},
+		{
+			http.MethodPost,
+			"/track",
+			url.Values{"data": {`{"event":"d","properties":{"token":"wrong"}}`}, "verbose": {"1"}},
+			200,
+			"application/json",
+			`{"status":0,"error":"event #0: invalid project token"}`,
+		},
+		{http.MethodGet, "/track?img=1" + data, nil, 200, "image/png", "\x89PNG"},
+		{http.MethodGet, "/track?callback=mp._jsc.cb" + data, nil, 200, "text/javascript", "mp._jsc.cb(1);"},
+		{http.MethodGet, "/track?callback=alert(1)" + data, nil, 400, "text/plain", "invalid callback"},
+		{http.MethodGet, "/track?redirect=https://example.com/x" + data, nil, 302, "", ""},
+		{http.MethodGet, "/track?redirect=https://evil.com/" + data, nil, 400, "text/plain", "not allowed"},
+		{http.MethodGet, "/track?redirect=/thanks" + data, nil, 302, "", ""},
+		{http.MethodGet, "/track?redirect=" + url.QueryEscape(`/\evil.com`) + data, nil, 400, "text/plain", "backslash"},
+		{http.MethodGet, "/track?redirect=" + url.QueryEscape(`/x\y`) + data, nil, 400, "text/plain", "backslash"},
+		{http.MethodGet, "/track?redirect=//evil.com" + data, nil, 400, "text/plain", "not allowed"},
+		{http.MethodGet, "/track?redirect=///evil.com" + data, nil, 400, "text/plain", "absolute path"},
+		{
+			http.MethodPost,
+			"/engage",
+			url.Values{"data": {`{"$token":"token","$distinct_id":"u1","$set":{"plan":"pro"}}`}},
+			200,
+			"text/plain",
+			"1",
+		},
+		{http.MethodPost, "/engage", url.Values{"data": {`{"$token":"token","$distinct_id":"u1"}`}}, 200, "text/plain", "0"},
+		{http.MethodGet, "/decide", nil, 404, "text/plain", "not found"},
+		{http.MethodDelete, "/track", nil, 405, "text/plain", "not allowed"},
+	}
+
+	for i, c := range cases {
+		req := httptest.NewRequest(c.method, c.target, nil)
+		if c.form != nil {
+			req = httptest.NewRequest(c.method, c.target, strings.NewReader(c.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		if rec.Code != c.status {
+			t.Fatalf("[#%d] expected status: %d, actual: %d, body: %s", i, c.status, rec.Code, rec.Body)
+		}
+
+		if !strings.HasPrefix(rec.Header().Get("Content-Type"), c.contentType) {
+			t.Fatalf("[#%d] unexpected content type: %s", i, rec.Header().Get("Content-Type"))
+		}
+
+		if !strings.Contains(rec.Body.String(), c.body) {
+			t.Fatalf("[#%d] expected body contains: %q, actual: %q", i, c.body, rec.Body)
+		}
+	}
+
+	// event "c" is resent by several requests and deduplicated by `$insert_id` derived from its content
+	events := emulator.Events()
+	if len(events) != 3 {
+		t.Fatalf("unexpected number of events: %d", len(events))
+	}
+
+	// httptest.NewRequest uses 192.0.2.1 as remote address
+	if events[0].Properties.IP != "192.0.2.1" || events[1].Properties.IP != "10.0.0.1" || events[2].Properties.IP != "" {
+		t.Fatalf("unexpected IP of events: %+v", events[:3])
+	}
+
+	if properties, ok := emulator.Profile("u1"); !ok || properties["plan"] != "pro" {
+		t.Fatalf("unexpected profile: %v", properties)
+	}
+}
+
+func TestProxy_retried_chunks(t *testing.T) {
+	emulator := ingestiontest.NewEmulator()
+
+	var requests int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the second chunk fails once
+		if atomic.AddInt32(&requests, 1) == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		emulator.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client, err := ingestion.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy, err := web.NewProxy(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	items := []string{}
+	for i := 0; i < ingestion.TrackBatchLimit+10; i++ {
+		items = append(items, fmt.Sprintf(`{"event":"e","properties":{"n":%d,"time":1700000000.5}}`, i))
+	}
+
+	data := url.Values{"data": {"[" + strings.Join(items, ",") + "]"}}
+	expected := []int{http.StatusServiceUnavailable, http.StatusOK}
+
+	for i, status := range expected {
+		req := httptest.NewRequest(http.MethodPost, "/track", strings.NewReader(data.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, req)
+
+		if rec.Code != status {
+			t.Fatalf("[#%d] expected status: %d, actual: %d", i, status, rec.Code)
+		}
+	}
+
+	if events := emulator.Events(); len(events) != len(items) {
+		t.Fatalf("expected %d events, actual: %d", len(items), len(events))
+	}
+}
+
+func TestProxy_unavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client, err := ingestion.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy, err := web.NewProxy(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/track?data="+url.QueryEscape(`{"event":"a","properties":{}}`), nil)
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("unexpected status: %d", rec.Code)
+	}
+}
+
+func TestProxy_rejected(t *testing.T) {
+	emulator := ingestiontest.NewEmulator(ingestiontest.WithProjectToken("token"))
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	client, err := ingestion.NewClient(server.URL, ingestion.WithProjectToken("token", ingestion.RejectTokenMismatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	unreachable, err := ingestion.NewClient(closed.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		client ingestion.Client
+		query  string
+		status int
+		body   string
+	}{
+		{client, "data=", 200, `{"status":0,"error":"data is empty"}`},
+		{client, "data=%21%21%21", 200, `{"status":0,"error":"data is neither JSON nor base64-encoded JSON"}`},
+		{client, "data=W10=", 200, `{"status":0,"error":"data list is empty"}`},
+		{client, "data=" + url.QueryEscape(`{"event":"a","properties":{"token":"other"}}`), 200, "token mismatch"},
+		{client, "data=" + url.QueryEscape(`{"event":"a"}`), 200, `{"status":1}`},
+		{unreachable, "data=" + url.QueryEscape(`{"event":"a"}`), 502, "Bad Gateway"},
+	}
+
+	for i, c := range cases {
+		proxy, err := web.NewProxy(c.client)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/track?verbose=1&"+c.query, nil))
+
+		if rec.Code != c.status || !strings.Contains(rec.Body.String(), c.body) {
+			t.Fatalf("[#%d] unexpected response: %d %s", i, rec.Code, rec.Body)
+		}
+	}
+
+	if events := emulator.Events(); len(events) != 1 || events[0].Properties.Token != "token" {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestProxy_browser_sdk(t *testing.T) {
+	emulator := ingestiontest.NewEmulator(ingestiontest.WithProjectToken("token"))
+	server := httptest.NewServer(emulator)
+	defer server.Close()
+
+	client, err := ingestion.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proxy, err := web.NewProxy(client, web.WithClientIP(web.RemoteIP))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// payload of mixpanel-js, time is fractional seconds
+	data := base64.StdEncoding.EncodeToString([]byte(`[{"event":"$mp_web_page_view","properties":{` +
+		`"$os":"Mac OS X","$browser":"Chrome","$current_url":"https://example.com/","$lib_version":"2.47.0",` +
+		`"mp_lib":"web","distinct_id":"$device:18b","$device_id":"18b","$insert_id":"r8kq3m9cz2x","token":"token",` +
+		`"time":1700000000.123,"mp_sent_by_lib_version":"2.47.0"}}]`))
+	form := url.Values{"data": {data}, "ip": {"1"}, "verbose": {"1"}}
+
+	req := httptest.NewRequest(http.MethodPost, "/track/?_=1700000000456", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || rec.Body.String() != `{"status":1}` {
+		t.Fatalf("unexpected response: %d %s", rec.Code, rec.Body)
+	}
+
+	events := emulator.Events()
+	if len(events) != 1 {
+		t.Fatalf("unexpected number of events: %d", len(events))
+	}
+
+	if p := events[0].Properties; p.Time.Unix() != 1700000000 || p.DistinctID != "$device:18b" || p.IP != "192.0.2.1" {
+		t.Fatalf("unexpected properties: %+v", p)
+	}
+}
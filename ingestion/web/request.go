@@ -0,0 +1,228 @@
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+)
+
+// Mixpanel default properties filled from request.
+const (
+	PropertyBrowser        = "$browser"
+	PropertyBrowserVersion = "$browser_version"
+	PropertyOS             = "$os"
+	PropertyDevice         = "$device"
+	PropertyCurrentURL     = "$current_url"
+	PropertyLocale         = "locale"
+)
+
+// Enricher fills event properties from incoming http.Request:
+// IP of client, browser, OS and device by User-Agent header, URL of request and preferred locale.
+// Headers of proxies, i.e. X-Forwarded-For, Forwarded and X-Forwarded-Proto,
+// are trusted only if request came from trusted proxy.
+type Enricher struct {
+	trusted []*net.IPNet
+}
+
+// NewEnricher builds Enricher which trusts proxies with specified IP addresses or CIDR ranges,
+// e.g. "10.0.0.0/8" for load balancers within private network.
+func NewEnricher(trustedProxies ...string) (*Enricher, error) {
+	e := &Enricher{}
+
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", proxy)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			e.trusted = append(e.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %w", err)
+		}
+
+		e.trusted = append(e.trusted, network)
+	}
+
+	return e, nil
+}
+
+// Properties builds event properties of request.
+func (e *Enricher) Properties(r *http.Request) event.Properties {
+	p := event.Properties{}
+	e.Enrich(r, &p)
+
+	return p
+}
+
+// Enrich sets properties of request which are not set yet.
+// It can be passed to WithProperties option of middleware.
+func (e *Enricher) Enrich(r *http.Request, p *event.Properties) {
+	if p.IP == "" {
+		p.IP = e.ClientIP(r)
+	}
+
+	if p.CustomProperties == nil {
+		p.CustomProperties = event.CustomProperties{}
+	}
+
+	set := func(name string, value interface{}, ok bool) {
+		if _, exists := p.CustomProperties[name]; ok && !exists {
+			p.CustomProperties[name] = value
+		}
+	}
+
+	agent := ParseUserAgent(r.UserAgent())
+	set(PropertyBrowser, agent.Browser, agent.Browser != "")
+	set(PropertyBrowserVersion, agent.BrowserVersion, agent.BrowserVersion != 0)
+	set(PropertyOS, agent.OS, agent.OS != "")
+	set(PropertyDevice, agent.Device, agent.Device != "")
+	set(PropertyCurrentURL, e.currentURL(r), r.Host != "")
+
+	locale := preferredLocale(r.Header.Get("Accept-Language"))
+	set(PropertyLocale, locale, locale != "")
+}
+
+// ClientIP returns IP of client which sent the request.
+// Chain of forwarding proxies is walked from the nearest one while proxies are trusted.
+// Forwarded header takes precedence over X-Forwarded-For one.
+// It can be passed to WithClientIP option of Proxy.
+func (e *Enricher) ClientIP(r *http.Request) string {
+	ip := RemoteIP(r)
+	if !e.isTrusted(ip) {
+		return ip
+	}
+
+	hops := forwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			// obfuscated or malformed identifier, previous hop is the most reliable one
+			break
+		}
+
+		ip = hops[i]
+		if !e.isTrusted(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (e *Enricher) isTrusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range e.trusted {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// currentURL returns absolute URL of request, scheme of trusted proxy is respected.
+func (e *Enricher) currentURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if e.isTrusted(RemoteIP(r)) {
+		if proto := forwardedProto(r.Header); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+	}
+
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// forwardedFor returns addresses of clients and proxies from the farthest to the nearest one.
+func forwardedFor(header http.Header) []string {
+	hops := []string{}
+
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		for _, element := range forwardedElements(values) {
+			hops = append(hops, stripPort(element["for"]))
+		}
+
+		return hops
+	}
+
+	for _, value := range header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, stripPort(strings.TrimSpace(hop)))
+		}
+	}
+
+	return hops
+}
+
+func forwardedProto(header http.Header) string {
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		elements := forwardedElements(values)
+
+		return strings.ToLower(elements[len(elements)-1]["proto"])
+	}
+
+	proto := strings.Split(header.Get("X-Forwarded-Proto"), ",")
+
+	return strings.ToLower(strings.TrimSpace(proto[len(proto)-1]))
+}
+
+// forwardedElements parses pairs of Forwarded header, see RFC 7239.
+func forwardedElements(values []string) []map[string]string {
+	elements := []map[string]string{}
+
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			pairs := map[string]string{}
+
+			for _, pair := range strings.Split(element, ";") {
+				parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+				if len(parts) == 2 {
+					pairs[strings.ToLower(parts[0])] = strings.Trim(parts[1], `"`)
+				}
+			}
+
+			elements = append(elements, pairs)
+		}
+	}
+
+	return elements
+}
+
+// stripPort removes port and brackets of IPv6 address.
+func stripPort(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+}
+
+// preferredLocale returns the first language tag of Accept-Language header.
+func preferredLocale(header string) string {
+	tag := strings.TrimSpace(strings.SplitN(strings.SplitN(header, ",", 2)[0], ";", 2)[0])
+	if tag == "*" {
+		return ""
+	}
+
+	return tag
+}
@@ -0,0 +1,101 @@
+package web_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion/event"
+	"github.com/wtask-go/mixpanel/ingestion/web"
+)
+
+func TestEnricher_ClientIP(t *testing.T) {
+	enricher, err := web.NewEnricher("10.0.0.0/8", "192.0.2.1", "2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		remote   string
+		header   map[string]string
+		expected string
+	}{
+		{"203.0.113.7:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"192.0.2.1:1234", nil, "192.0.2.1"},
+		{"192.0.2.1:1234", map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.1, 10.1.1.1"}, "198.51.100.1"},
+		{"192.0.2.1:1234", map[string]string{"X-Forwarded-For": "10.2.2.2, 10.1.1.1"}, "10.2.2.2"},
+		{"192.0.2.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1, unknown"}, "192.0.2.1"},
+		{
+			"[2001:db8::1]:443",
+			map[string]string{
+				"Forwarded":       `for="[2001:db8:cafe::17]:4711", for=198.51.100.2;proto=https`,
+				"X-Forwarded-For": "6.6.6.6",
+			},
+			"198.51.100.2",
+		},
+	}
+
+	for i, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remote
+
+		for name, value := range c.header {
+			req.Header.Set(name, value)
+		}
+
+		if actual := enricher.ClientIP(req); actual != c.expected {
+			t.Fatalf("[#%d] expected IP: %s, actual: %s", i, c.expected, actual)
+		}
+	}
+
+	if _, err := web.NewEnricher("not an IP"); err == nil {
+		t.Fatal("expected error for invalid trusted proxy")
+	}
+}
+
+func TestEnricher_Enrich(t *testing.T) {
+	enricher, err := web.NewEnricher("192.0.2.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://shop.example.com/cart?step=2", nil)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:89.0) Gecko/20100101 Firefox/89.0")
+	req.Header.Set("Accept-Language", "de-CH, de;q=0.9, en;q=0.8")
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	req.Header.Set("X-Forwarded-Proto", "https")
+
+	p := enricher.Properties(req)
+
+	expected := event.CustomProperties{
+		web.PropertyBrowser:        "Firefox",
+		web.PropertyBrowserVersion: 89.0,
+		web.PropertyOS:             "Linux",
+		web.PropertyCurrentURL:     "https://shop.example.com/cart?step=2",
+		web.PropertyLocale:         "de-CH",
+	}
+
+	if p.IP != "198.51.100.1" || len(p.CustomProperties) != len(expected) {
+		t.Fatalf("unexpected properties: %+v", p)
+	}
+
+	for name, value := range expected {
+		if p.CustomProperties[name] != value {
+			t.Fatalf("expected %s: %v, actual: %v", name, value, p.CustomProperties[name])
+		}
+	}
+
+	// explicit values are kept, scheme of untrusted request is not overridden by header
+	req.RemoteAddr = "203.0.113.7:1234"
+	req.TLS = &tls.ConnectionState{}
+	req.Header.Set("X-Forwarded-Proto", "http")
+
+	p = event.Properties{IP: "127.0.0.1", CustomProperties: event.CustomProperties{web.PropertyOS: "Plan 9"}}
+	enricher.Enrich(req, &p)
+
+	if p.IP != "127.0.0.1" || p.CustomProperties[web.PropertyOS] != "Plan 9" ||
+		p.CustomProperties[web.PropertyCurrentURL] != "https://shop.example.com/cart?step=2" {
+		t.Fatalf("unexpected properties: %+v", p)
+	}
+}
@@ -0,0 +1,167 @@
+package web
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// UserAgent describes browser, OS and device in terms of Mixpanel default properties.
+// Empty values mean they were not detected.
+type UserAgent struct {
+	// Browser is the value of $browser property, e.g. "Chrome" or "Mobile Safari".
+	Browser string
+	// BrowserVersion is the value of $browser_version property, major and minor version as number.
+	BrowserVersion float64
+	// OS is the value of $os property, e.g. "Windows" or "Mac OS X".
+	OS string
+	// Device is the value of $device property, e.g. "iPhone" or "Android".
+	Device string
+}
+
+// Tokens of User-Agent which are also values of properties.
+const (
+	android    = "Android"
+	blackBerry = "BlackBerry"
+	wpDesktop  = "WPDesktop"
+)
+
+var (
+	blackBerryPattern   = regexp.MustCompile(`(?i)(BlackBerry|PlayBook|BB10)`)
+	windowsPattern      = regexp.MustCompile(`(?i)Windows`)
+	macPattern          = regexp.MustCompile(`(?i)Mac`)
+	windowsPhonePattern = regexp.MustCompile(`(?i)Windows Phone`)
+
+	// browserVersions contains patterns of browser versions, the version is the last submatch.
+	browserVersions = map[string]*regexp.Regexp{
+		"Internet Explorer Mobile": regexp.MustCompile(`rv:(\d+(\.\d+)?)`),
+		"Microsoft Edge":           regexp.MustCompile(`Edge?/(\d+(\.\d+)?)`),
+		"Chrome":                   regexp.MustCompile(`Chrome/(\d+(\.\d+)?)`),
+		"Chrome iOS":               regexp.MustCompile(`CriOS/(\d+(\.\d+)?)`),
+		"UC Browser":               regexp.MustCompile(`(UCBrowser|UCWEB)/(\d+(\.\d+)?)`),
+		"Safari":                   regexp.MustCompile(`Version/(\d+(\.\d+)?)`),
+		"Mobile Safari":            regexp.MustCompile(`Version/(\d+(\.\d+)?)`),
+		"Opera":                    regexp.MustCompile(`(Opera|OPR)/(\d+(\.\d+)?)`),
+		"Firefox":                  regexp.MustCompile(`Firefox/(\d+(\.\d+)?)`),
+		"Firefox iOS":              regexp.MustCompile(`FxiOS/(\d+(\.\d+)?)`),
+		"Konqueror":                regexp.MustCompile(`Konqueror[:/](\d+(\.\d+)?)`),
+		blackBerry:                 regexp.MustCompile(`BlackBerry (\d+(\.\d+)?)`),
+		"Android Mobile":           regexp.MustCompile(`(?i)android\s(\d+(\.\d+)?)`),
+		"Samsung Internet":         regexp.MustCompile(`SamsungBrowser/(\d+(\.\d+)?)`),
+		"Internet Explorer":        regexp.MustCompile(`(rv:|MSIE )(\d+(\.\d+)?)`),
+		"Mozilla":                  regexp.MustCompile(`rv:(\d+(\.\d+)?)`),
+	}
+)
+
+// ParseUserAgent detects browser, OS and device from User-Agent header
+// with the same rules and values as Mixpanel JavaScript SDK.
+func ParseUserAgent(ua string) UserAgent {
+	agent := UserAgent{
+		Browser: detectBrowser(ua),
+		OS:      detectOS(ua),
+		Device:  detectDevice(ua),
+	}
+
+	if pattern, ok := browserVersions[agent.Browser]; ok {
+		if match := pattern.FindStringSubmatch(ua); match != nil {
+			// the last submatch is minor part of version
+			agent.BrowserVersion, _ = strconv.ParseFloat(match[len(match)-2], 64)
+		}
+	}
+
+	return agent
+}
+
+func detectBrowser(ua string) string {
+	has := func(s string) bool { return strings.Contains(ua, s) }
+
+	switch {
+	case has(" OPR/"):
+		if has("Mini") {
+			return "Opera Mini"
+		}
+
+		return "Opera"
+	case blackBerryPattern.MatchString(ua):
+		return blackBerry
+	case has("IEMobile") || has(wpDesktop):
+		return "Internet Explorer Mobile"
+	case has("SamsungBrowser/"):
+		return "Samsung Internet"
+	case has("Edge") || has("Edg/"):
+		return "Microsoft Edge"
+	case has("FBIOS"):
+		return "Facebook Mobile"
+	case has("Chrome"):
+		return "Chrome"
+	case has("CriOS"):
+		return "Chrome iOS"
+	case has("UCWEB") || has("UCBrowser"):
+		return "UC Browser"
+	case has("FxiOS"):
+		return "Firefox iOS"
+	case has("Safari/") && has("Version/"):
+		// browsers of Apple are detected by navigator.vendor in JavaScript SDK
+		if has("Mobile") {
+			return "Mobile Safari"
+		}
+
+		return "Safari"
+	case has(android):
+		return "Android Mobile"
+	case has("Konqueror"):
+		return "Konqueror"
+	case has("Firefox"):
+		return "Firefox"
+	case has("MSIE") || has("Trident/"):
+		return "Internet Explorer"
+	case has("Gecko"):
+		return "Mozilla"
+	}
+
+	return ""
+}
+
+func detectOS(ua string) string {
+	switch {
+	case windowsPattern.MatchString(ua):
+		if strings.Contains(ua, "Phone") || strings.Contains(ua, wpDesktop) {
+			return "Windows Phone"
+		}
+
+		return "Windows"
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad") || strings.Contains(ua, "iPod"):
+		return "iOS"
+	case strings.Contains(ua, android):
+		return android
+	case blackBerryPattern.MatchString(ua):
+		return blackBerry
+	case macPattern.MatchString(ua):
+		return "Mac OS X"
+	case strings.Contains(ua, "Linux"):
+		return "Linux"
+	case strings.Contains(ua, "CrOS"):
+		return "Chrome OS"
+	}
+
+	return ""
+}
+
+func detectDevice(ua string) string {
+	switch {
+	case windowsPhonePattern.MatchString(ua) || strings.Contains(ua, wpDesktop):
+		return "Windows Phone"
+	case strings.Contains(ua, "iPad"):
+		return "iPad"
+	case strings.Contains(ua, "iPod"):
+		return "iPod Touch"
+	case strings.Contains(ua, "iPhone"):
+		return "iPhone"
+	case blackBerryPattern.MatchString(ua):
+		return blackBerry
+	case strings.Contains(ua, android):
+		return android
+	}
+
+	return ""
+}
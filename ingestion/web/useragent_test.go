@@ -0,0 +1,65 @@
+package web_test
+
+import (
+	"testing"
+
+	"github.com/wtask-go/mixpanel/ingestion/web"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		ua       string
+		expected web.UserAgent
+	}{
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) " +
+				"Chrome/91.0.4472.124 Safari/537.36",
+			web.UserAgent{Browser: "Chrome", BrowserVersion: 91.0, OS: "Windows"},
+		},
+		{
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) " +
+				"Version/14.1.1 Safari/605.1.15",
+			web.UserAgent{Browser: "Safari", BrowserVersion: 14.1, OS: "Mac OS X"},
+		},
+		{
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) " +
+				"Version/14.1.1 Mobile/15E148 Safari/604.1",
+			web.UserAgent{Browser: "Mobile Safari", BrowserVersion: 14.1, OS: "iOS", Device: "iPhone"},
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 14_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) " +
+				"CriOS/91.0.4472.80 Mobile/15E148 Safari/604.1",
+			web.UserAgent{Browser: "Chrome iOS", BrowserVersion: 91.0, OS: "iOS", Device: "iPad"},
+		},
+		{
+			"Mozilla/5.0 (Linux; Android 11; SM-G991B) AppleWebKit/537.36 (KHTML, like Gecko) " +
+				"SamsungBrowser/14.2 Chrome/87.0.4280.141 Mobile Safari/537.36",
+			web.UserAgent{Browser: "Samsung Internet", BrowserVersion: 14.2, OS: "Android", Device: "Android"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) " +
+				"Chrome/91.0.4472.124 Safari/537.36 Edg/91.0.864.59",
+			web.UserAgent{Browser: "Microsoft Edge", BrowserVersion: 91.0, OS: "Windows"},
+		},
+		{
+			"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:89.0) Gecko/20100101 Firefox/89.0",
+			web.UserAgent{Browser: "Firefox", BrowserVersion: 89.0, OS: "Linux"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			web.UserAgent{Browser: "Internet Explorer", BrowserVersion: 11.0, OS: "Windows"},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) " +
+				"Chrome/91.0.4472.114 Safari/537.36 OPR/77.0.4054.172",
+			web.UserAgent{Browser: "Opera", BrowserVersion: 77.0, OS: "Windows"},
+		},
+		{"curl/7.64.1", web.UserAgent{}},
+	}
+
+	for i, c := range cases {
+		if actual := web.ParseUserAgent(c.ua); actual != c.expected {
+			t.Fatalf("[#%d] expected: %+v, actual: %+v", i, c.expected, actual)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package form
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"net/url"
+	"strings"
 )
 
 // OptionalValue is intended to pass not mandatory request values.
@@ -94,3 +98,50 @@ func WithJavascriptCallback(callback string) OptionalValue {
 		}
 	}
 }
+
+// DecodeData decodes `data` value received from Mixpanel clients.
+// Value is either JSON or base64-encoded JSON as official SDKs send it.
+func DecodeData(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("data is empty")
+	}
+
+	if value[0] == '{' || value[0] == '[' {
+		return []byte(value), nil
+	}
+
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding,
+	} {
+		if data, err := encoding.DecodeString(value); err == nil {
+			return data, nil
+		}
+	}
+
+	return nil, fmt.Errorf("data is neither JSON nor base64-encoded JSON")
+}
+
+// DecodeItems decodes `data` value into list of JSON objects,
+// batch reports the value is JSON array rather than single object. Empty array is rejected as Mixpanel does.
+func DecodeItems(value string) (items []json.RawMessage, batch bool, err error) {
+	data, err := DecodeData(value)
+	if err != nil {
+		return nil, false, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		return []json.RawMessage{data}, false, nil
+	}
+
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, false, fmt.Errorf("invalid data: %w", err)
+	}
+
+	if len(items) == 0 {
+		return nil, true, fmt.Errorf("data list is empty")
+	}
+
+	return items, true, nil
+}
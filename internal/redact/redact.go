@@ -0,0 +1,39 @@
+// Package redact hides tokens and secrets of Mixpanel payloads in logs and recordings.
+package redact
+
+// Placeholder replaces sensitive values.
+const Placeholder = "[REDACTED]"
+
+// sensitiveKeys are names of JSON properties, form values and URL parameters which values must be hidden.
+var sensitiveKeys = map[string]bool{
+	"token":      true,
+	"$token":     true,
+	"api_key":    true,
+	"api_secret": true,
+	"secret":     true,
+}
+
+// IsSensitive reports whether value of JSON property, form value or URL parameter with specified name must be hidden.
+func IsSensitive(name string) bool {
+	return sensitiveKeys[name]
+}
+
+// JSON replaces values of sensitive keys in decoded JSON in place and returns it.
+func JSON(data interface{}) interface{} {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if sensitiveKeys[key] {
+				v[key] = Placeholder
+			} else {
+				v[key] = JSON(value)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = JSON(v[i])
+		}
+	}
+
+	return data
+}